@@ -5,12 +5,18 @@ import (
 	"compliance-form-filler/pkg/logger"
 	"context"
 	"os"
+	"os/signal"
+	"syscall"
 )
 
 func main() {
 	app := app.InitApp()
 
-	if err := app.Run(context.Background(), os.Args); err != nil {
+	// Cancel the in-flight requests on Ctrl-C or when the container is stopped
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	if err := app.Run(ctx, os.Args); err != nil {
 		logger.DefaultLogger.Fatal().Err(err).Msg("Failed to run")
 	}
 }
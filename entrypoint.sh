@@ -8,6 +8,7 @@ ARGS="answer"
 [ -n "$QDRANT_URL" ] && ARGS="$ARGS --qdrant-url \"$QDRANT_URL\""
 [ -n "$LLM_URL" ] && ARGS="$ARGS --llm-url \"$LLM_URL\""
 [ -n "$EMBEDDING_API_URL" ] && ARGS="$ARGS --embedding-api-url \"$EMBEDDING_API_URL\""
+[ -n "$BASELINE_FILE" ] && ARGS="$ARGS --baseline \"$BASELINE_FILE\""
 
 while :; do
   STATUS=$(curl -s http://ingestor:8000/ready | jq -r '.status')
@@ -15,4 +16,4 @@ while :; do
   sleep 30
 done
 
-eval ./compliance-form-filler $ARGS
\ No newline at end of file
+eval exec ./compliance-form-filler $ARGS
\ No newline at end of file
@@ -7,6 +7,8 @@ require (
 	github.com/qdrant/go-client v1.15.1
 	github.com/rs/zerolog v1.34.0
 	github.com/urfave/cli/v3 v3.3.8
+	google.golang.org/grpc v1.66.0
+	google.golang.org/protobuf v1.34.2
 )
 
 require (
@@ -17,6 +19,4 @@ require (
 	golang.org/x/sys v0.28.0 // indirect
 	golang.org/x/text v0.21.0 // indirect
 	google.golang.org/genproto/googleapis/rpc v0.0.0-20240827150818-7e3bb234dfed // indirect
-	google.golang.org/grpc v1.66.0 // indirect
-	google.golang.org/protobuf v1.34.2 // indirect
 )
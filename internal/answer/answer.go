@@ -1,37 +1,65 @@
 package answer
 
 import (
+	"compliance-form-filler/pkg/common"
+	"compliance-form-filler/pkg/corpus"
 	"compliance-form-filler/pkg/embedding"
 	"compliance-form-filler/pkg/iohandler"
+	"compliance-form-filler/pkg/language"
 	"compliance-form-filler/pkg/llm"
 	"compliance-form-filler/pkg/logger"
+	"compliance-form-filler/pkg/prompt"
+	"compliance-form-filler/pkg/rerank"
+	"compliance-form-filler/pkg/retry"
 	"context"
+	"errors"
 	"fmt"
-	"strconv"
+	"os"
+	"path/filepath"
 	"strings"
+	"time"
 
 	"github.com/qdrant/go-client/qdrant"
 	"github.com/urfave/cli/v3"
 )
 
+// Policies applied when a question fails
 const (
-	qdrantCollectionName  = "compliance_corpus"
-	qdrantTextFieldName   = "text"
-	qdrantSourceFieldName = "source"
+	// OnErrorSkip leaves the question out of the output
+	OnErrorSkip = "skip"
+	// OnErrorAbort stops the run, saving the answers completed so far
+	OnErrorAbort = "abort"
+	// OnErrorMark keeps the question in the output with an error status
+	OnErrorMark = "mark"
 )
 
-func Answer(cmd *cli.Command) error {
+// History modes between questions
+const (
+	HistoryIsolate = "isolate"
+	HistoryCarry   = "carry"
+)
+
+const (
+	qdrantCollectionName      = corpus.CollectionName
+	qdrantTextFieldName       = corpus.TextField
+	qdrantSourceFieldName     = corpus.SourceField
+	qdrantChunkIndexFieldName = corpus.ChunkIndexField
+)
+
+func Answer(ctx context.Context, cmd *cli.Command) error {
 	// Read the flags and perform the necessary actions
 	if cmd == nil {
 		return fmt.Errorf("nil command")
 	}
+	startedAt := time.Now()
 	sourceFile := cmd.String("source-file")
 	outputFile := cmd.String("output-file")
 	qdrantURL := cmd.String("qdrant-url")
 	llmURL := cmd.String("llm-url")
 	embeddingApiURL := cmd.String("embedding-api-url")
+	baselineFile := cmd.String("baseline")
 
-	qdrantHost, qdrantPort, err := ProcessUrl(qdrantURL)
+	qdrantHost, qdrantPort, err := common.ProcessUrl(qdrantURL)
 	if err != nil {
 		return fmt.Errorf("failed to process Qdrant URL: %w", err)
 	}
@@ -42,8 +70,22 @@ func Answer(cmd *cli.Command) error {
 	if err != nil {
 		return fmt.Errorf("failed to read source file: %w", err)
 	}
+	// Detect the language of each question, to search the corpus and answer accordingly
+	for index := range questions {
+		questions[index].Language = language.Detect(questions[index].Text)
+	}
 	logger.DefaultLogger.Info().Msgf("Questions parsed!")
 
+	var baseline *Baseline
+	if baselineFile != "" {
+		logger.DefaultLogger.Info().Msgf("Loading baseline file: %s ...", baselineFile)
+		baseline, err = LoadBaseline(baselineFile, cmd.Float("baseline-similarity"))
+		if err != nil {
+			return err
+		}
+		logger.DefaultLogger.Info().Msgf("Baseline loaded, %d approved answers available", baseline.Len())
+	}
+
 	qdrantClient, err := qdrant.NewClient(&qdrant.Config{
 		Host: qdrantHost,
 		Port: qdrantPort,
@@ -52,115 +94,380 @@ func Answer(cmd *cli.Command) error {
 		return fmt.Errorf("failed to create Qdrant client: %w", err)
 	}
 
-	questionsAnswered := make(map[string]string)
-	var llmTaskContext = `You are a compliance assistant. You answer each question **only** using the provided context header (a ranked list of snippets like: "Response 3: <text> (score: 0.94) (source: <title of the source document>").
-
-Rules
-1) **Use only the header content.** If the answer cannot be found in the header, reply exactly: **"No information available"**.
-2) **Never invent or infer beyond the header.** Do not rely on prior knowledge or assumptions.
-3) **Ranking & selection.**
-   - Prefer higher score snippets.
-   - When snippets conflict, choose the highest-scoring. If still tied, choose the one most specific to the question.
-   - If evidence is partial or ambiguous, reply **"No information available"**.
-4) **Precision & completeness.**
-   - Extract the best answer and compile them into a short, ready-to-use response.
-   - If the question implies a "Yes"/"No" question, reply "Yes” or “No” and justify the answer. **Never let an answer be only "Yes" or "No"**. If not clearly supported, reply **"No information available"**.
-5) **Output format.**
-   - Style: precise, formal, and concise; no preamble.
-   - Length: maximum 7 lines.
-   - Return **only** the final answer, no restatements of the question, no references to scores or snippets.
-6) **Keep in mind the questions are addressed to the company, not to you**. If a questions contains "you", it means the company, not you as an AI assistant.
-
-Process (follow silently)
-a) Read the question and header.
-b) From the snippets, resolve conflicts (highest score).
-c) If a direct answer is present, output it verbatim or lightly edited for grammar; otherwise output **"No information available"**. **Never let an answer be only "Yes" or "No"** .`
-
-	// Prepare and send the context prompt for the LLM
-	logger.DefaultLogger.Info().Msgf("Sending context to LLM: %s", llmTaskContext)
-	_, llmContext, err := llm.SendPromptToLLM(llmURL, llmTaskContext, []int{})
+	// Load the prompt templates and render the task description
+	templates, err := prompt.Load(cmd.String("prompt-dir"))
 	if err != nil {
-		return fmt.Errorf("failed to send prompt to LLM: %w", err)
+		return fmt.Errorf("failed to load prompt templates: %w", err)
 	}
-	logger.DefaultLogger.Info().Msgf("Searching for answers to %d questions...", len(questions))
-	for _, question := range questions {
-		// Vectorize the question using the embedding API
-		logger.DefaultLogger.Info().Msgf("Embedding question: %s", question)
-		vector, err := embedding.EmbedString(question, embeddingApiURL)
+	logger.DefaultLogger.Info().Msgf("Prompt templates loaded (version: %s, hash: %s)", templates.Version, templates.Hash)
+	promptVariables := prompt.Variables{
+		CompanyName:   cmd.String("company-name"),
+		Product:       cmd.String("product"),
+		Questionnaire: cmd.String("questionnaire-name"),
+	}
+	if promptVariables.Questionnaire == "" {
+		promptVariables.Questionnaire = strings.TrimSuffix(filepath.Base(sourceFile), filepath.Ext(sourceFile))
+	}
+	llmTaskContext, err := templates.System(promptVariables)
+	if err != nil {
+		return err
+	}
+
+	// Every conversation starts with the task description, followed by the few-shot examples if any
+	baseMessages := []llm.Message{{Role: llm.RoleSystem, Content: llmTaskContext}}
+	if fewShotFile := cmd.String("few-shot-file"); fewShotFile != "" {
+		logger.DefaultLogger.Info().Msgf("Loading few-shot examples: %s ...", fewShotFile)
+		examples, err := LoadFewShotExamples(fewShotFile)
 		if err != nil {
-			logger.DefaultLogger.Error().Msgf("failed to vectorize question: %s", question)
-			continue
+			return err
+		}
+		examplesMessages, err := fewShotMessages(templates, promptVariables, examples)
+		if err != nil {
+			return err
 		}
-		logger.DefaultLogger.Info().Msgf("Question vectorized successfully")
+		baseMessages = append(baseMessages, examplesMessages...)
+		logger.DefaultLogger.Info().Msgf("%d few-shot examples loaded", len(examples))
+	}
+	logger.DefaultLogger.Debug().Msgf("System prompt: %s", llmTaskContext)
 
-		// Search in Qdrant using the vector
-		logger.DefaultLogger.Info().Msgf("Searching in Qdrant for question: %s", question)
-		var scoreThreshold float32 = 0.4
-		searchResult, err := qdrantClient.Query(context.Background(), &qdrant.QueryPoints{
-			CollectionName: qdrantCollectionName,
-			Query:          qdrant.NewQuery(vector...),
-			WithPayload:    qdrant.NewWithPayload(true),
-			ScoreThreshold: &scoreThreshold,
-		})
+	// Generation options not set keep the model defaults
+	llmOptions := llm.Options{
+		NumCtx:     cmd.Int("num-ctx"),
+		NumPredict: cmd.Int("num-predict"),
+		Stop:       cmd.StringSlice("stop"),
+	}
+	if cmd.IsSet("temperature") {
+		temperature := cmd.Float("temperature")
+		llmOptions.Temperature = &temperature
+	}
+	if cmd.IsSet("top-p") {
+		topP := cmd.Float("top-p")
+		llmOptions.TopP = &topP
+	}
+	if cmd.IsSet("seed") {
+		seed := cmd.Int("seed")
+		llmOptions.Seed = &seed
+	}
+	// The token budget defaults to the context window requested from the model
+	contextTokens := cmd.Int("context-window")
+	if contextTokens == 0 {
+		contextTokens = llmOptions.NumCtx
+	}
+	// and the model is asked for the context window the prompt was fitted to
+	if llmOptions.NumCtx == 0 {
+		llmOptions.NumCtx = contextTokens
+	}
+	llmClient := llm.NewClient(llmURL, cmd.String("llm-model"), llmOptions)
+	llmClient.Stream = cmd.Bool("stream")
+	llmClient.FirstTokenTimeout = cmd.Duration("llm-first-token-timeout")
+	llmClient.Timeout = cmd.Duration("llm-timeout")
+
+	// Every external dependency is retried with the same policy, and has its own circuit breaker
+	retryPolicy := retry.Policy{
+		MaxAttempts:    cmd.Int("retry-max-attempts"),
+		InitialBackoff: cmd.Duration("retry-initial-backoff"),
+		MaxBackoff:     cmd.Duration("retry-max-backoff"),
+	}
+	breakerThreshold := cmd.Int("circuit-breaker-threshold")
+	llmClient.Breaker = retry.NewBreaker("LLM", breakerThreshold, retryPolicy)
+	embeddingClient := embedding.NewClient(embeddingApiURL, retry.NewBreaker("embedding API", breakerThreshold, retryPolicy))
+	qdrantBreaker := retry.NewBreaker("Qdrant", breakerThreshold, retryPolicy)
+
+	// Restrict the searches to the chunks matching the filters of the questionnaire and the flags
+	var filterConditions []string
+	if filtersFile := cmd.String("filters-file"); filtersFile != "" {
+		logger.DefaultLogger.Info().Msgf("Loading filters: %s ...", filtersFile)
+		filterConditions, err = LoadFilterConditions(filtersFile)
 		if err != nil {
-			logger.DefaultLogger.Error().Msgf("qdrant search failed for question: %s - %s", question, err)
-			continue
+			return err
 		}
-		logger.DefaultLogger.Info().Msgf("Qdrant search completed")
-		if len(searchResult) == 0 {
-			logger.DefaultLogger.Warn().Msgf("No results found for this question")
-			// Store a default answer if no results found
-			questionsAnswered[question] = "No information available"
-			continue
-		} else {
-			// Build the context string from search results and call the LLM
-			var promptBuilder strings.Builder
-			for index, point := range searchResult {
-				if text, ok := point.Payload[qdrantTextFieldName]; ok {
-					// Build the context mentioning for each point its index, its value and its score
-					if source, ok := point.Payload[qdrantSourceFieldName]; ok {
-						promptBuilder.WriteString(fmt.Sprintf("Response %d: %s (score: %.2f) (source: %s)", index+1, text.GetStringValue(), point.Score, source.GetStringValue()))
-						promptBuilder.WriteString("\n\n")
-					}
+	}
+	filterConditions = append(filterConditions, cmd.StringSlice("filter")...)
+	filter, err := BuildFilter(filterConditions)
+	if err != nil {
+		return err
+	}
+	if filter != nil {
+		logger.DefaultLogger.Info().Msgf("Searches filtered on: %s", strings.Join(filterConditions, ", "))
+	}
+
+	var synonyms Synonyms
+	if synonymsFile := cmd.String("synonyms-file"); synonymsFile != "" {
+		logger.DefaultLogger.Info().Msgf("Loading synonyms: %s ...", synonymsFile)
+		synonyms, err = LoadSynonyms(synonymsFile)
+		if err != nil {
+			return err
+		}
+		logger.DefaultLogger.Info().Msgf("%d synonym entries loaded", len(synonyms))
+	}
+
+	var reranker rerank.Reranker
+	switch cmd.String("reranker") {
+	case RerankerCrossEncoder:
+		reranker = rerank.NewCrossEncoder(cmd.String("reranker-url"), retry.NewBreaker("reranker", breakerThreshold, retryPolicy))
+	case RerankerLLM:
+		reranker = rerank.NewLLMJudge(llmClient)
+	}
+	liveOutput := cmd.Bool("live-output")
+	answerClient := llmClient
+	if liveOutput {
+		// Print the answers on stderr while they are generated, keeping stdout for the logs.
+		// Only the answers are printed, the other calls to the LLM going through llmClient.
+		streamingClient := *llmClient
+		streamingClient.OnToken = func(token string) {
+			fmt.Fprint(os.Stderr, token)
+		}
+		answerClient = &streamingClient
+	}
+
+	// A language required by the format rules is also the language the answers are generated in
+	forcedLanguage := cmd.String("answer-language")
+	if forcedLanguage == "" {
+		forcedLanguage = cmd.String("required-language")
+	}
+
+	p := &pipeline{
+		qdrantClient:        qdrantClient,
+		qdrantBreaker:       qdrantBreaker,
+		llmClient:           llmClient,
+		answerClient:        answerClient,
+		embeddingClient:     embeddingClient,
+		retrievalMode:       cmd.String("retrieval"),
+		hybridWeight:        cmd.Float("hybrid-weight"),
+		sparseVectorName:    cmd.String("sparse-vector-name"),
+		filter:              filter,
+		synonyms:            synonyms,
+		queryRewrites:       cmd.Int("query-rewrites"),
+		reranker:            reranker,
+		rerankTopN:          cmd.Int("rerank-top-n"),
+		neighborChunks:      cmd.Int("neighbor-chunks"),
+		dedupThreshold:      cmd.Float("dedup-threshold"),
+		mmrTopK:             cmd.Int("mmr-top-k"),
+		mmrLambda:           cmd.Float("mmr-lambda"),
+		contextTokens:       contextTokens,
+		answerTokens:        cmd.Int("answer-token-reserve"),
+		maxHops:             cmd.Int("max-hops"),
+		decompose:           cmd.Bool("decompose"),
+		forcedLanguage:      forcedLanguage,
+		corpusLanguage:      cmd.String("corpus-language"),
+		baseMessages:        baseMessages,
+		carryHistory:        cmd.String("history") == HistoryCarry,
+		templates:           templates,
+		promptVariables:     promptVariables,
+		confidenceThreshold: cmd.Float("confidence-threshold"),
+		verifyMode:          cmd.String("verify"),
+		verifyAction:        cmd.String("verify-action"),
+		structured:          cmd.Bool("structured"),
+		structuredRetries:   cmd.Int("structured-retries"),
+		validator: FormatValidator{
+			MaxLines:          cmd.Int("max-lines"),
+			MaxCharacters:     cmd.Int("max-characters"),
+			ForbidBareVerdict: cmd.Bool("forbid-bare-verdict"),
+			ForbiddenPhrases:  cmd.StringSlice("forbidden-phrases"),
+			Language:          cmd.String("required-language"),
+		},
+		formatRetries: cmd.Int("format-retries"),
+	}
+
+	onError := cmd.String("on-error")
+	followUps := cmd.String("follow-ups")
+	// parentQuestion is the last question of the section which is not a follow-up, parent its result if it was answered
+	var parentQuestion string
+	var parent *iohandler.Result
+	var results []iohandler.Result
+	interrupted := false
+	var abortErr error
+	logger.DefaultLogger.Info().Msgf("Searching for answers to %d questions...", len(questions))
+	for index, item := range questions {
+		question := item.Text
+		// Stop on SIGINT/SIGTERM, keeping the answers completed so far
+		if ctx.Err() != nil {
+			interrupted = true
+			results = append(results, notProcessedResults(questions[index:])...)
+			break
+		}
+
+		// A follow-up never refers to a question of another section
+		if index > 0 && item.Section != questions[index-1].Section {
+			parentQuestion, parent = "", nil
+		}
+		isFollowUp, condition := false, ""
+		if followUps != FollowUpsIgnore {
+			isFollowUp, condition = followUpCondition(question)
+			isFollowUp = isFollowUp && parentQuestion != ""
+		}
+		if !isFollowUp {
+			parentQuestion, parent = question, nil
+		}
+
+		// Carry over the previous answer if the question did not change
+		if baseline != nil {
+			// Follow-ups are matched along with their parent question, each parent calling for its own follow-up answer
+			questionToMatch := question
+			if isFollowUp {
+				questionToMatch = contextualizeQuestion(question, parentQuestion)
+			}
+			previous, similarity, ok := baseline.Match(item.Section, questionToMatch)
+			if ok && !compatiblePreviousAnswer(previous, item) {
+				logger.DefaultLogger.Info().Msgf("Question found in baseline with other options, answering it again: %s", question)
+				ok = false
+			}
+			if ok {
+				logger.DefaultLogger.Info().Msgf("Question found in baseline (similarity: %.2f), carrying over the previous answer: %s", similarity, question)
+				// The previous answer was approved for the exact same question only, a near-match is reviewed again
+				carriedOver := iohandler.Result{
+					Section:     item.Section,
+					Question:    question,
+					Type:        item.Type,
+					Options:     item.Options,
+					Language:    item.Language,
+					Answer:      previous.Answer,
+					Selected:    previous.Selected,
+					Verdict:     previous.Verdict,
+					Status:      iohandler.StatusCarriedOver,
+					Confidence:  1,
+					NeedsReview: previous.NeedsReview,
 				}
+				if similarity < 1 {
+					carriedOver.Confidence = similarity
+					carriedOver.NeedsReview = true
+					carriedOver.Notes = fmt.Sprintf("carried over from a similar question (similarity: %.2f)", similarity)
+				}
+				results = append(results, carriedOver)
+				if !isFollowUp {
+					parent = &carriedOver
+				}
+				continue
 			}
-			prompt := promptBuilder.String()
-			// Prepare the full prompt for the LLM
-			prompt = fmt.Sprintf("%s\n\n ===== %s", prompt, question)
-			// Call the LLM with the prompt
-			logger.DefaultLogger.Info().Msgf("Sending prompt to LLM: %s", prompt)
-			answer, _, err := llm.SendPromptToLLM(llmURL, prompt, llmContext)
-			if err != nil {
-				return fmt.Errorf("failed to send prompt to LLM: %w", err)
+		}
+
+		// A follow-up is answered in the context of its parent, unless the answer of the parent rules it out
+		questionToAnswer, promptContext := question, ""
+		mismatch := false
+		if isFollowUp {
+			mismatch = conditionMismatch(condition, parent)
+			if mismatch && followUps == FollowUpsSkip {
+				logger.DefaultLogger.Info().Msgf("Follow-up not applicable given the answer of the previous question: %s", question)
+				results = append(results, notApplicableResult(item, parentQuestion, parent))
+				continue
 			}
-			logger.DefaultLogger.Info().Msgf("LLM response received for question: %s", question)
-			// Store the answer in the map
-			questionsAnswered[question] = answer
+			questionToAnswer = contextualizeQuestion(question, parentQuestion)
+			promptContext = parentAnswerContext(parent)
+		}
+
+		if liveOutput {
+			fmt.Fprintf(os.Stderr, "\n>>> %s\n", question)
+		}
+		result, err := p.answerQuestion(ctx, questionToAnswer, item, promptContext)
+		if liveOutput {
+			fmt.Fprintln(os.Stderr)
+		}
+		if err != nil {
+			if ctx.Err() != nil {
+				interrupted = true
+				results = append(results, notProcessedResults(questions[index:])...)
+				break
+			}
+			logger.DefaultLogger.Error().Msgf("Failed to answer question: %s - %s", question, err)
+			// A dependency clearly down fails the run early, whatever the policy
+			if onError == OnErrorAbort || errors.Is(err, retry.ErrCircuitOpen) {
+				abortErr = err
+				results = append(results, errorResult(item, err))
+				results = append(results, notProcessedResults(questions[index+1:])...)
+				break
+			}
+			if onError == OnErrorMark {
+				results = append(results, errorResult(item, err))
+			}
+			continue
+		}
+		result.Section, result.Question, result.Language = item.Section, question, item.Language
+		result.Type, result.Options = item.Type, item.Options
+		if mismatch {
+			result.NeedsReview = true
+			result.Notes = appendNote(result.Notes, fmt.Sprintf("follow-up possibly not applicable, the previous question was answered %s", answerPolarity(parent)))
+		}
+		if result.Status == "" {
+			result.Status = iohandler.StatusAnswered
+			if !isApprovedAnswer(result.Answer) {
+				result.Status = iohandler.StatusNoInformation
+			}
+		}
+		results = append(results, *result)
+		if !isFollowUp {
+			parent = result
 		}
 	}
-	logger.DefaultLogger.Info().Msgf("All questions processed, %d answers generated", len(questionsAnswered))
+	if interrupted {
+		logger.DefaultLogger.Warn().Msgf("Run interrupted, saving the answers completed so far")
+	} else if abortErr != nil {
+		logger.DefaultLogger.Error().Msgf("Run aborted, saving the answers completed so far")
+	} else {
+		logger.DefaultLogger.Info().Msgf("All questions processed, %d answers generated", len(results))
+	}
 
 	// Save the results to the output file
 	logger.DefaultLogger.Info().Msgf("Saving answers to output file: %s ...", outputFile)
-	err = iohandler.WriteFile(outputFile, questionsAnswered)
+	err = iohandler.WriteFile(outputFile, results)
 	if err != nil {
 		return fmt.Errorf("failed to write output file: %w", err)
 	}
 	logger.DefaultLogger.Info().Msgf("Answers saved to successfully!")
 
+	// Save the metadata of the run for reproducibility
+	err = iohandler.WriteMetadata(outputFile, iohandler.RunMetadata{
+		StartedAt:     startedAt,
+		SourceFile:    sourceFile,
+		PromptVersion: templates.Version,
+		PromptHash:    templates.Hash,
+		Interrupted:   interrupted || abortErr != nil,
+		LLMModel:      llmClient.Model,
+		LLMOptions:    llmClient.Options,
+		Filters:       filterConditions,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to write metadata file: %w", err)
+	}
+	logger.DefaultLogger.Info().Msgf("Run metadata saved to %s", iohandler.MetadataPath(outputFile))
+
+	if interrupted {
+		return fmt.Errorf("run interrupted, partial results saved: %w", ctx.Err())
+	}
+	if abortErr != nil {
+		return fmt.Errorf("run aborted, partial results saved: %w", abortErr)
+	}
+
 	return nil
 }
 
-// ProcessUrl get host and port from the URL
-func ProcessUrl(url string) (string, int, error) {
-	parts := strings.Split(url, ":")
-	if len(parts) != 2 {
-		return "", 0, fmt.Errorf("invalid URL format, expected 'host:port'")
+// errorResult keeps a failed question in the output, along with the reason of the failure
+func errorResult(question iohandler.Question, err error) iohandler.Result {
+	return iohandler.Result{
+		Section:     question.Section,
+		Question:    question.Text,
+		Type:        question.Type,
+		Options:     question.Options,
+		Language:    question.Language,
+		Status:      iohandler.StatusError,
+		NeedsReview: true,
+		Notes:       err.Error(),
 	}
-	host := parts[0]
-	port, err := strconv.Atoi(parts[1])
-	if err != nil {
-		return "", 0, fmt.Errorf("invalid port number: %w", err)
+}
+
+// notProcessedResults marks the questions left unanswered when the run is interrupted
+func notProcessedResults(questions []iohandler.Question) []iohandler.Result {
+	results := make([]iohandler.Result, 0, len(questions))
+	for _, question := range questions {
+		results = append(results, iohandler.Result{
+			Section:     question.Section,
+			Question:    question.Text,
+			Type:        question.Type,
+			Options:     question.Options,
+			Language:    question.Language,
+			Status:      iohandler.StatusNotProcessed,
+			NeedsReview: true,
+			Notes:       "run interrupted before the question was processed",
+		})
 	}
-	return host, port, nil
+	return results
 }
@@ -0,0 +1,225 @@
+package answer
+
+import (
+	"compliance-form-filler/pkg/iohandler"
+	"fmt"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+const noInformationAnswer = "No information available"
+
+// romanNumeralRegexp matches the roman numerals used in versions, like "Type II"
+var romanNumeralRegexp = regexp.MustCompile(`^(i{1,3}|iv|vi{0,3}|ix|x)$`)
+
+// baselineKey identifies a question of a previous run: the same question may appear in several sections
+type baselineKey struct {
+	section  string
+	question string
+}
+
+// Baseline holds the answers of a previous run, used to avoid re-answering unchanged questions.
+type Baseline struct {
+	// answers indexed by normalized section and question
+	answers map[baselineKey]iohandler.PreviousAnswer
+	// keys of the answers, sorted to keep fuzzy matching deterministic
+	keys []baselineKey
+	// sectioned is false for files written before the Section column, matched on the question only
+	sectioned bool
+	// minimum similarity (between 0 and 1) for a fuzzy match
+	similarity float64
+}
+
+// LoadBaseline reads the results of a previous run and keeps only the approved answers, i.e. the ones answered
+// or carried over, not flagged for review, and neither empty nor "No information available".
+// Follow-up questions are indexed along with their parent question, as contextualizeQuestion does, since the same
+// "If yes, please describe it." may follow several questions.
+func LoadBaseline(filePath string, similarity float64) (*Baseline, error) {
+	previous, sectioned, err := iohandler.ReadAnswers(filePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read baseline file: %w", err)
+	}
+
+	baseline := &Baseline{
+		answers:    make(map[baselineKey]iohandler.PreviousAnswer),
+		sectioned:  sectioned,
+		similarity: similarity,
+	}
+	parentQuestion := ""
+	for index, answer := range previous {
+		// A follow-up never refers to a question of another section
+		if index > 0 && answer.Section != previous[index-1].Section {
+			parentQuestion = ""
+		}
+		question := answer.Question
+		if isFollowUp, _ := followUpCondition(question); isFollowUp && parentQuestion != "" {
+			question = contextualizeQuestion(question, parentQuestion)
+		} else {
+			parentQuestion = question
+		}
+		if !isApprovedPreviousAnswer(answer) {
+			continue
+		}
+		key := baseline.key(answer.Section, question)
+		if _, ok := baseline.answers[key]; !ok {
+			baseline.keys = append(baseline.keys, key)
+		}
+		baseline.answers[key] = answer
+	}
+	sort.Slice(baseline.keys, func(i, j int) bool {
+		if baseline.keys[i].section != baseline.keys[j].section {
+			return baseline.keys[i].section < baseline.keys[j].section
+		}
+		return baseline.keys[i].question < baseline.keys[j].question
+	})
+
+	return baseline, nil
+}
+
+// Len returns the number of approved answers in the baseline.
+func (b *Baseline) Len() int {
+	return len(b.answers)
+}
+
+// Match looks for the question of the section in the baseline, first exactly (after normalization) and then fuzzily
+// among the questions of the same section. It returns the previous answer, the similarity of the match and whether
+// a match was found.
+func (b *Baseline) Match(section, question string) (iohandler.PreviousAnswer, float64, bool) {
+	key := b.key(section, question)
+	if answer, ok := b.answers[key]; ok {
+		return answer, 1, true
+	}
+
+	bestScore := 0.0
+	var bestKey *baselineKey
+	numbers := numberTokens(key.question)
+	for index, candidate := range b.keys {
+		if candidate.section != key.section {
+			continue
+		}
+		// A single character apart, "SOC 1" and "SOC 2" are different questions
+		if !slices.Equal(numbers, numberTokens(candidate.question)) {
+			continue
+		}
+		score := similarityRatio(key.question, candidate.question)
+		if score > bestScore {
+			bestScore = score
+			bestKey = &b.keys[index]
+		}
+	}
+	if bestKey == nil || bestScore < b.similarity {
+		return iohandler.PreviousAnswer{}, bestScore, false
+	}
+	return b.answers[*bestKey], bestScore, true
+}
+
+// key normalizes the section and the question, ignoring the section for files without a Section column
+func (b *Baseline) key(section, question string) baselineKey {
+	if !b.sectioned {
+		section = ""
+	}
+	return baselineKey{section: normalizeQuestion(section), question: normalizeQuestion(question)}
+}
+
+// isApprovedPreviousAnswer tells whether an answer of a previous run can be carried over without a new review
+func isApprovedPreviousAnswer(answer iohandler.PreviousAnswer) bool {
+	if answer.NeedsReview || !isApprovedAnswer(answer.Answer) {
+		return false
+	}
+	// Files written before the Status column only hold answers
+	switch answer.Status {
+	case "", iohandler.StatusAnswered, iohandler.StatusCarriedOver:
+		return true
+	default:
+		return false
+	}
+}
+
+// compatiblePreviousAnswer tells whether a previous answer still fits the question: same type and same options,
+// the selection being one of these options. Files written before the Question Type column only hold text answers.
+func compatiblePreviousAnswer(previous iohandler.PreviousAnswer, question iohandler.Question) bool {
+	previousType := previous.Type
+	if previousType == "" {
+		previousType = iohandler.QuestionTypeText
+	}
+	if previousType != question.Type {
+		return false
+	}
+	if question.Type == iohandler.QuestionTypeText {
+		return true
+	}
+	if !slices.Equal(previous.Options, question.Options) || len(previous.Selected) == 0 {
+		return false
+	}
+	for _, selected := range previous.Selected {
+		if !slices.Contains(question.Options, selected) {
+			return false
+		}
+	}
+	return question.Type == iohandler.QuestionTypeSelectAll || len(previous.Selected) == 1
+}
+
+func isApprovedAnswer(answer string) bool {
+	answer = strings.TrimSpace(answer)
+	return answer != "" && answer != noInformationAnswer
+}
+
+// normalizeQuestion lowercases the question, drops punctuation and collapses whitespaces
+// so that cosmetic changes between two questionnaires are ignored.
+func normalizeQuestion(question string) string {
+	var builder strings.Builder
+	for _, r := range strings.ToLower(question) {
+		switch {
+		case unicode.IsLetter(r), unicode.IsDigit(r):
+			builder.WriteRune(r)
+		case unicode.IsSpace(r), unicode.IsPunct(r):
+			builder.WriteRune(' ')
+		}
+	}
+	return strings.Join(strings.Fields(builder.String()), " ")
+}
+
+// numberTokens returns the words of a normalized question made of digits or roman numerals,
+// like the "2" of "SOC 2", the "1" and "3" of "TLS 1.3" or the "ii" of "Type II", which fuzzy matches must keep.
+func numberTokens(normalized string) []string {
+	var numbers []string
+	for _, word := range strings.Fields(normalized) {
+		if strings.IndexFunc(word, unicode.IsDigit) >= 0 || romanNumeralRegexp.MatchString(word) {
+			numbers = append(numbers, word)
+		}
+	}
+	return numbers
+}
+
+// similarityRatio returns 1 - levenshtein(a, b) / max(len(a), len(b)), computed on runes.
+func similarityRatio(a, b string) float64 {
+	ra, rb := []rune(a), []rune(b)
+	longest := max(len(ra), len(rb))
+	if longest == 0 {
+		return 1
+	}
+	return 1 - float64(levenshtein(ra, rb))/float64(longest)
+}
+
+func levenshtein(a, b []rune) int {
+	previous := make([]int, len(b)+1)
+	current := make([]int, len(b)+1)
+	for j := range previous {
+		previous[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		current[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			current[j] = min(previous[j]+1, current[j-1]+1, previous[j-1]+cost)
+		}
+		previous, current = current, previous
+	}
+	return previous[len(b)]
+}
@@ -0,0 +1,115 @@
+package answer
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func writeBaseline(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "baseline.csv")
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestBaselineMatch(t *testing.T) {
+	path := writeBaseline(t, `Section,Question,Answer,Status,Needs Review
+Security,Is data encrypted at rest?,Yes with AES-256.,answered,false
+Security,"If yes, please describe it.",Keys are rotated yearly.,answered,false
+Audits,Do you hold a SOC 2 report?,Yes since 2021.,carried-over,false
+Audits,Do you hold a Type II report?,Yes.,answered,false
+Audits,Is TLS 1.3 enforced?,Yes on every endpoint.,answered,false
+Audits,Do you run penetration tests?,Yearly.,answered,true
+Audits,Do you have a bug bounty?,No information available,no-information,false
+Privacy,Do you have a DPO?,Yes.,error,false
+`)
+	baseline, err := LoadBaseline(path, 0.9)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := baseline.Len(), 5; got != want {
+		t.Errorf("Len() = %d, want %d", got, want)
+	}
+
+	tests := []struct {
+		name           string
+		section        string
+		question       string
+		wantAnswer     string
+		wantSimilarity float64
+		wantFound      bool
+	}{
+		{name: "exact", section: "Security", question: "Is data encrypted at rest?", wantAnswer: "Yes with AES-256.", wantSimilarity: 1, wantFound: true},
+		{name: "normalized", section: " security ", question: "is data encrypted at rest", wantAnswer: "Yes with AES-256.", wantSimilarity: 1, wantFound: true},
+		{name: "fuzzy", section: "Security", question: "Is data encripted at rest?", wantAnswer: "Yes with AES-256.", wantFound: true},
+		{name: "other section", section: "Privacy", question: "Is data encrypted at rest?"},
+		{name: "different digit", section: "Audits", question: "Do you hold a SOC 1 report?"},
+		{name: "different version", section: "Audits", question: "Is TLS 1.2 enforced?"},
+		{name: "different roman numeral", section: "Audits", question: "Do you hold a Type I report?"},
+		{
+			name:           "follow-up with its parent",
+			section:        "Security",
+			question:       contextualizeQuestion("If yes, please describe it.", "Is data encrypted at rest?"),
+			wantAnswer:     "Keys are rotated yearly.",
+			wantSimilarity: 1,
+			wantFound:      true,
+		},
+		{name: "follow-up alone", section: "Security", question: "If yes, please describe it."},
+		{name: "flagged for review", section: "Audits", question: "Do you run penetration tests?"},
+		{name: "no information", section: "Audits", question: "Do you have a bug bounty?"},
+		{name: "failed", section: "Privacy", question: "Do you have a DPO?"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			answer, similarity, found := baseline.Match(tt.section, tt.question)
+			if found != tt.wantFound {
+				t.Fatalf("Match() found = %t, want %t", found, tt.wantFound)
+			}
+			if !found {
+				return
+			}
+			if answer.Answer != tt.wantAnswer {
+				t.Errorf("Match() answer = %q, want %q", answer.Answer, tt.wantAnswer)
+			}
+			if tt.wantSimilarity == 1 && similarity != 1 {
+				t.Errorf("Match() similarity = %f, want 1", similarity)
+			}
+			if tt.wantSimilarity != 1 && (similarity < 0.9 || similarity >= 1) {
+				t.Errorf("Match() similarity = %f, want between 0.9 and 1", similarity)
+			}
+		})
+	}
+}
+
+func TestBaselineMatchWithoutSection(t *testing.T) {
+	path := writeBaseline(t, `Question,Answer
+Is data encrypted at rest?,Yes with AES-256.
+`)
+	baseline, err := LoadBaseline(path, 0.9)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, found := baseline.Match("Security", "Is data encrypted at rest?"); !found {
+		t.Errorf("Match() of a file without Section column should ignore the section")
+	}
+}
+
+func TestBaselineFollowUpAcrossSections(t *testing.T) {
+	path := writeBaseline(t, `Section,Question,Answer,Status,Needs Review
+Security,Is data encrypted at rest?,Yes with AES-256.,answered,false
+Privacy,"If yes, please describe it.",A DPO is appointed.,answered,false
+`)
+	baseline, err := LoadBaseline(path, 0.9)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, found := baseline.Match("Privacy", "If yes, please describe it."); !found {
+		t.Errorf("Match() of a follow-up opening a section should not use the question of the previous section")
+	}
+	if _, _, found := baseline.Match("Privacy", contextualizeQuestion("If yes, please describe it.", "Is data encrypted at rest?")); found {
+		t.Errorf("Match() found a follow-up attached to the question of the previous section")
+	}
+}
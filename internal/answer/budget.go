@@ -0,0 +1,58 @@
+package answer
+
+import (
+	"compliance-form-filler/pkg/iohandler"
+	"compliance-form-filler/pkg/logger"
+	"compliance-form-filler/pkg/tokens"
+	"slices"
+
+	"github.com/qdrant/go-client/qdrant"
+)
+
+// fitTokenBudget keeps the snippets, most relevant first, whose prompt fits in the context window of the model
+// once the conversation, the question and the tokens reserved for the answer are accounted for.
+// Snippets which do not fit are dropped and logged, instead of letting the LLM server silently truncate the prompt.
+func (p *pipeline) fitTokenBudget(question string, points []*qdrant.ScoredPoint) ([]*qdrant.ScoredPoint, error) {
+	if p.contextTokens <= 0 {
+		return points, nil
+	}
+	model := p.llmClient.Model
+
+	used := p.answerTokens
+	for _, message := range p.baseMessages {
+		used += tokens.EstimateMessage(model, message.Content)
+	}
+	for _, message := range p.history {
+		used += tokens.EstimateMessage(model, message.Content)
+	}
+	if p.current.Type != iohandler.QuestionTypeText {
+		used += tokens.Estimate(model, choiceAnswerInstructions(p.current))
+	} else if p.structured {
+		used += tokens.Estimate(model, structuredAnswerInstructions)
+	}
+
+	// Measure the question prompt as rendered by the template, which may be a custom one, with each snippet added
+	questionPrompt, err := p.buildPrompt(question, nil)
+	if err != nil {
+		return nil, err
+	}
+	promptTokens := tokens.EstimateMessage(model, questionPrompt)
+	var kept []*qdrant.ScoredPoint
+	for _, point := range points {
+		candidatePrompt, err := p.buildPrompt(question, append(slices.Clip(kept), point))
+		if err != nil {
+			return nil, err
+		}
+		candidateTokens := tokens.EstimateMessage(model, candidatePrompt)
+		if used+candidateTokens > p.contextTokens {
+			logger.DefaultLogger.Warn().Msgf("Snippet of %s (score: %.2f, ~%d tokens) dropped, exceeding the token budget of %d",
+				point.Payload[qdrantSourceFieldName].GetStringValue(), point.Score, candidateTokens-promptTokens, p.contextTokens)
+			continue
+		}
+		promptTokens = candidateTokens
+		kept = append(kept, point)
+	}
+	used += promptTokens
+	logger.DefaultLogger.Info().Msgf("Prompt uses ~%d of %d tokens, answer reserve included", used, p.contextTokens)
+	return kept, nil
+}
@@ -0,0 +1,67 @@
+package answer
+
+import (
+	"compliance-form-filler/pkg/iohandler"
+	"compliance-form-filler/pkg/llm"
+	"compliance-form-filler/pkg/prompt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/qdrant/go-client/qdrant"
+)
+
+func TestFitTokenBudget(t *testing.T) {
+	// A custom template rendering each snippet three times, 121 characters or ~31 tokens with a llama model
+	dir := t.TempDir()
+	template := "Q: {{.Question}}\n{{range .Snippets}}{{.Text}}{{.Text}}{{.Text}}\n{{end}}"
+	if err := os.WriteFile(filepath.Join(dir, prompt.QuestionTemplateName), []byte(template), 0644); err != nil {
+		t.Fatal(err)
+	}
+	templates, err := prompt.Load(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var points []*qdrant.ScoredPoint
+	for id := uint64(1); id <= 3; id++ {
+		points = append(points, &qdrant.ScoredPoint{
+			Id:    qdrant.NewIDNum(id),
+			Score: 0.8,
+			Payload: map[string]*qdrant.Value{
+				qdrantTextFieldName:   qdrant.NewValueString(strings.Repeat("x", 40)),
+				qdrantSourceFieldName: qdrant.NewValueString("policy.pdf"),
+			},
+		})
+	}
+
+	tests := []struct {
+		name          string
+		contextTokens int
+		answerTokens  int
+		want          int
+	}{
+		{name: "no budget", contextTokens: 0, want: 3},
+		{name: "all snippets fit", contextTokens: 100, want: 3},
+		{name: "rendered size counted", contextTokens: 50, want: 1},
+		{name: "answer reserve counted", contextTokens: 50, answerTokens: 20, want: 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := &pipeline{
+				llmClient:     llm.NewClient("", "llama3.1:8b", llm.Options{}),
+				templates:     templates,
+				contextTokens: tt.contextTokens,
+				answerTokens:  tt.answerTokens,
+				current:       iohandler.Question{Text: "Q?", Type: iohandler.QuestionTypeText},
+			}
+			kept, err := p.fitTokenBudget("Q?", points)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(kept) != tt.want {
+				t.Errorf("fitTokenBudget() kept %d snippets, want %d", len(kept), tt.want)
+			}
+		})
+	}
+}
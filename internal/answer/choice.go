@@ -0,0 +1,99 @@
+package answer
+
+import (
+	"compliance-form-filler/pkg/iohandler"
+	"compliance-form-filler/pkg/llm"
+	"context"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// ChoiceAnswer is the answer returned by the LLM to a choice or select-all question
+type ChoiceAnswer struct {
+	Selected      []string `json:"selected"`
+	Justification string   `json:"justification"`
+	CitedSnippets []int    `json:"cited_snippets"`
+}
+
+// choiceAnswerSchema returns the JSON schema restricting the selection to the options of the question
+func choiceAnswerSchema(question iohandler.Question) (json.RawMessage, error) {
+	selected := map[string]any{
+		"type":  "array",
+		"items": map[string]any{"type": "string", "enum": question.Options},
+	}
+	if question.Type == iohandler.QuestionTypeChoice {
+		selected["maxItems"] = 1
+	}
+	schema := map[string]any{
+		"type": "object",
+		"properties": map[string]any{
+			"selected":       selected,
+			"justification":  map[string]any{"type": "string"},
+			"cited_snippets": map[string]any{"type": "array", "items": map[string]any{"type": "integer"}},
+		},
+		"required": []string{"selected", "justification", "cited_snippets"},
+	}
+	return json.Marshal(schema)
+}
+
+// choiceAnswerInstructions returns the instructions appended to the prompt of a choice or select-all question
+func choiceAnswerInstructions(question iohandler.Question) string {
+	selection := "exactly one of the options"
+	if question.Type == iohandler.QuestionTypeSelectAll {
+		selection = "every option that applies"
+	}
+	return fmt.Sprintf(`The allowed options are: %s.
+Reply only with a JSON object with the following fields:
+- "selected": %s, written exactly as listed, empty when no information is available,
+- "justification": the justification of the selection following the rules above, or "%s",
+- "cited_snippets": the numbers of the responses the selection is based on (e.g. [1, 3]), empty when no information is available.`,
+		strings.Join(question.Options, " | "), selection, noInformationAnswer)
+}
+
+// Validate checks the selection is allowed for the question, rewriting the options as listed in the questionnaire.
+// snippetCount is the number of snippets in the prompt.
+func (a *ChoiceAnswer) Validate(question iohandler.Question, snippetCount int) error {
+	var selected []string
+	for _, option := range a.Selected {
+		index := slices.IndexFunc(question.Options, func(allowed string) bool {
+			return strings.EqualFold(strings.TrimSpace(option), allowed)
+		})
+		if index < 0 {
+			return fmt.Errorf("option %q is not one of %s", option, strings.Join(question.Options, " | "))
+		}
+		if !slices.Contains(selected, question.Options[index]) {
+			selected = append(selected, question.Options[index])
+		}
+	}
+	a.Selected = selected
+
+	if strings.TrimSpace(a.Justification) == "" {
+		return fmt.Errorf("empty justification")
+	}
+	// No selection is only allowed when the snippets do not answer the question
+	if len(a.Selected) == 0 && strings.TrimSpace(a.Justification) != noInformationAnswer {
+		return fmt.Errorf("no option selected")
+	}
+	if question.Type == iohandler.QuestionTypeChoice && len(a.Selected) > 1 {
+		return fmt.Errorf("%d options selected, only one is allowed", len(a.Selected))
+	}
+	for _, snippet := range a.CitedSnippets {
+		if snippet < 1 || snippet > snippetCount {
+			return fmt.Errorf("cited snippet %d out of range [1, %d]", snippet, snippetCount)
+		}
+	}
+	return nil
+}
+
+// AskChoiceAnswer sends the conversation with the options of the question, and retries up to maxRetries times
+// when the selection is malformed or not allowed. The instructions are appended to the last message of the conversation.
+func AskChoiceAnswer(ctx context.Context, llmClient *llm.Client, messages []llm.Message, question iohandler.Question, snippetCount, maxRetries int) (ChoiceAnswer, error) {
+	schema, err := choiceAnswerSchema(question)
+	if err != nil {
+		return ChoiceAnswer{}, fmt.Errorf("failed to build choice answer schema: %w", err)
+	}
+	return askJSONAnswer(ctx, llmClient, messages, "choice", schema, choiceAnswerInstructions(question),
+		func(answer *ChoiceAnswer) error { return answer.Validate(question, snippetCount) }, maxRetries)
+}
@@ -0,0 +1,125 @@
+package answer
+
+import (
+	"compliance-form-filler/pkg/iohandler"
+	"compliance-form-filler/pkg/llm"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestChoiceAnswerValidate(t *testing.T) {
+	choice := iohandler.Question{Text: "Is data encrypted?", Type: iohandler.QuestionTypeChoice, Options: []string{"Yes", "No", "Partially"}}
+	selectAll := iohandler.Question{Text: "Which frameworks?", Type: iohandler.QuestionTypeSelectAll, Options: []string{"ISO 27001", "SOC 2", "PCI DSS"}}
+	tests := []struct {
+		name         string
+		question     iohandler.Question
+		answer       ChoiceAnswer
+		wantSelected []string
+		wantErr      bool
+	}{
+		{
+			name:         "options normalized",
+			question:     choice,
+			answer:       ChoiceAnswer{Selected: []string{" yes "}, Justification: "AES-256 is used.", CitedSnippets: []int{1}},
+			wantSelected: []string{"Yes"},
+		},
+		{
+			name:         "duplicates removed",
+			question:     selectAll,
+			answer:       ChoiceAnswer{Selected: []string{"soc 2", "ISO 27001", "SOC 2"}, Justification: "Both are certified."},
+			wantSelected: []string{"SOC 2", "ISO 27001"},
+		},
+		{
+			name:     "unknown option",
+			question: choice,
+			answer:   ChoiceAnswer{Selected: []string{"Maybe"}, Justification: "Unclear."},
+			wantErr:  true,
+		},
+		{
+			name:     "several options for a choice",
+			question: choice,
+			answer:   ChoiceAnswer{Selected: []string{"Yes", "Partially"}, Justification: "Depends."},
+			wantErr:  true,
+		},
+		{
+			name:     "empty justification",
+			question: choice,
+			answer:   ChoiceAnswer{Selected: []string{"Yes"}, Justification: " "},
+			wantErr:  true,
+		},
+		{
+			name:     "no selection",
+			question: selectAll,
+			answer:   ChoiceAnswer{Justification: "None of them."},
+			wantErr:  true,
+		},
+		{
+			name:     "no selection without information",
+			question: selectAll,
+			answer:   ChoiceAnswer{Justification: noInformationAnswer},
+		},
+		{
+			name:     "cited snippet out of range",
+			question: choice,
+			answer:   ChoiceAnswer{Selected: []string{"No"}, Justification: "Not encrypted.", CitedSnippets: []int{4}},
+			wantErr:  true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.answer.Validate(tt.question, 3)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && !slices.Equal(tt.answer.Selected, tt.wantSelected) {
+				t.Errorf("Validate() selected = %v, want %v", tt.answer.Selected, tt.wantSelected)
+			}
+		})
+	}
+}
+
+func TestAskChoiceAnswerRetriesWithFeedback(t *testing.T) {
+	replies := []string{
+		`{"selected": ["Maybe"], "justification": "Unclear.", "cited_snippets": []}`,
+		`{"selected": ["yes"], "justification": "AES-256 is used.", "cited_snippets": [1]}`,
+	}
+	var requests []llm.ChatRequest
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var request llm.ChatRequest
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			t.Error(err)
+			return
+		}
+		requests = append(requests, request)
+		_ = json.NewEncoder(w).Encode(llm.ChatResponse{Message: llm.Message{Role: llm.RoleAssistant, Content: replies[len(requests)-1]}, Done: true})
+	}))
+	defer server.Close()
+
+	question := iohandler.Question{Text: "Is data encrypted?", Type: iohandler.QuestionTypeChoice, Options: []string{"Yes", "No"}}
+	messages := []llm.Message{{Role: llm.RoleUser, Content: "Is data encrypted?"}}
+	answer, err := AskChoiceAnswer(context.Background(), llm.NewClient(server.URL, "", llm.Options{}), messages, question, 1, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(answer.Selected, []string{"Yes"}) {
+		t.Errorf("AskChoiceAnswer() selected = %v, want [Yes]", answer.Selected)
+	}
+	if len(requests) != 2 {
+		t.Fatalf("%d requests sent, want 2", len(requests))
+	}
+	retry := requests[1].Messages
+	if len(retry) != 3 || retry[1].Role != llm.RoleAssistant || retry[1].Content != replies[0] {
+		t.Fatalf("retry does not resend the rejected reply: %+v", retry)
+	}
+	if !strings.Contains(retry[2].Content, `option "Maybe" is not one of Yes | No`) {
+		t.Errorf("retry feedback = %q, want the validation error", retry[2].Content)
+	}
+	if messages[0].Content != "Is data encrypted?" {
+		t.Errorf("the conversation of the caller was modified: %q", messages[0].Content)
+	}
+}
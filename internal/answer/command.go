@@ -2,11 +2,16 @@ package answer
 
 import (
 	"compliance-form-filler/pkg/common"
+	"compliance-form-filler/pkg/corpus"
+	"compliance-form-filler/pkg/language"
+	"compliance-form-filler/pkg/llm"
+	"compliance-form-filler/pkg/retry"
 
 	"context"
 	"fmt"
 	"github.com/urfave/cli/v3"
 	"os"
+	"time"
 )
 
 var Command = &cli.Command{
@@ -35,10 +40,83 @@ var Command = &cli.Command{
 		},
 		&cli.StringFlag{
 			Name:     "llm-url",
-			Usage:    "URL for the LLM service",
+			Usage:    "URL of the chat endpoint of the LLM service",
 			Sources:  cli.EnvVars("LLM_URL"),
 			Required: false,
-			Value:    "http://localhost:11434/api/generate",
+			Value:    "http://localhost:11434/api/chat",
+		},
+		&cli.StringFlag{
+			Name:     "llm-model",
+			Usage:    "Name of the model used by the LLM service",
+			Sources:  cli.EnvVars("LLM_MODEL"),
+			Required: false,
+			Value:    llm.DefaultModel,
+		},
+		&cli.FloatFlag{
+			Name:     "temperature",
+			Usage:    "Sampling temperature of the LLM (model default if not set)",
+			Sources:  cli.EnvVars("LLM_TEMPERATURE"),
+			Required: false,
+		},
+		&cli.FloatFlag{
+			Name:     "top-p",
+			Usage:    "Nucleus sampling probability of the LLM (model default if not set)",
+			Sources:  cli.EnvVars("LLM_TOP_P"),
+			Required: false,
+		},
+		&cli.IntFlag{
+			Name:     "seed",
+			Usage:    "Random seed of the LLM, to get reproducible answers (random if not set)",
+			Sources:  cli.EnvVars("LLM_SEED"),
+			Required: false,
+		},
+		&cli.IntFlag{
+			Name:     "num-ctx",
+			Usage:    "Size of the context window of the LLM in tokens, 0 for the model default",
+			Sources:  cli.EnvVars("LLM_NUM_CTX"),
+			Required: false,
+			Value:    0,
+		},
+		&cli.IntFlag{
+			Name:     "num-predict",
+			Usage:    "Maximum number of tokens generated by the LLM, 0 for the model default",
+			Sources:  cli.EnvVars("LLM_NUM_PREDICT"),
+			Required: false,
+			Value:    0,
+		},
+		&cli.StringSliceFlag{
+			Name:     "stop",
+			Usage:    "Sequences stopping the generation of the LLM",
+			Sources:  cli.EnvVars("LLM_STOP"),
+			Required: false,
+		},
+		&cli.BoolFlag{
+			Name:     "stream",
+			Usage:    "Receive the LLM answers token by token",
+			Sources:  cli.EnvVars("LLM_STREAM"),
+			Required: false,
+			Value:    false,
+		},
+		&cli.BoolFlag{
+			Name:     "live-output",
+			Usage:    "Print the answers on stderr while they are generated (requires --stream)",
+			Sources:  cli.EnvVars("LIVE_OUTPUT"),
+			Required: false,
+			Value:    false,
+		},
+		&cli.DurationFlag{
+			Name:     "llm-first-token-timeout",
+			Usage:    "Maximum wait for the first token of an answer in streaming mode, 0 to disable",
+			Sources:  cli.EnvVars("LLM_FIRST_TOKEN_TIMEOUT"),
+			Required: false,
+			Value:    2 * time.Minute,
+		},
+		&cli.DurationFlag{
+			Name:     "llm-timeout",
+			Usage:    "Maximum duration of an LLM request, 0 to disable",
+			Sources:  cli.EnvVars("LLM_TIMEOUT"),
+			Required: false,
+			Value:    10 * time.Minute,
 		},
 		&cli.StringFlag{
 			Name:     "embedding-api-url",
@@ -47,9 +125,323 @@ var Command = &cli.Command{
 			Required: false,
 			Value:    "http://localhost:8000/embed",
 		},
+		&cli.IntFlag{
+			Name:     "retry-max-attempts",
+			Usage:    "Maximum number of attempts of a call to the embedding API, Qdrant or the LLM",
+			Sources:  cli.EnvVars("RETRY_MAX_ATTEMPTS"),
+			Required: false,
+			Value:    retry.DefaultPolicy.MaxAttempts,
+		},
+		&cli.DurationFlag{
+			Name:     "retry-initial-backoff",
+			Usage:    "Wait before the first retry, doubled after each retry (with jitter)",
+			Sources:  cli.EnvVars("RETRY_INITIAL_BACKOFF"),
+			Required: false,
+			Value:    retry.DefaultPolicy.InitialBackoff,
+		},
+		&cli.DurationFlag{
+			Name:     "retry-max-backoff",
+			Usage:    "Maximum wait between two retries",
+			Sources:  cli.EnvVars("RETRY_MAX_BACKOFF"),
+			Required: false,
+			Value:    retry.DefaultPolicy.MaxBackoff,
+		},
+		&cli.IntFlag{
+			Name:     "circuit-breaker-threshold",
+			Usage:    "Number of consecutive failed calls to a dependency after which the run fails, 0 to disable",
+			Sources:  cli.EnvVars("CIRCUIT_BREAKER_THRESHOLD"),
+			Required: false,
+			Value:    5,
+		},
+		&cli.StringFlag{
+			Name:     "on-error",
+			Usage:    "What to do when a question fails: skip it, abort the run, or mark it as an error in the output",
+			Sources:  cli.EnvVars("ON_ERROR"),
+			Required: false,
+			Value:    OnErrorMark,
+		},
+		&cli.StringFlag{
+			Name:     "baseline",
+			Usage:    ".csv file produced by a previous run, whose approved answers are carried over for unchanged questions",
+			Sources:  cli.EnvVars("BASELINE_FILE"),
+			Required: false,
+			Value:    "",
+		},
+		&cli.FloatFlag{
+			Name:     "baseline-similarity",
+			Usage:    "Minimum similarity (between 0 and 1) for a question to fuzzily match a baseline question",
+			Sources:  cli.EnvVars("BASELINE_SIMILARITY"),
+			Required: false,
+			Value:    0.9,
+		},
+		&cli.StringFlag{
+			Name:     "retrieval",
+			Usage:    "Retrieval mode: dense vector search, or hybrid dense and keyword search (requires the sparse vectors, see index-sparse)",
+			Sources:  cli.EnvVars("RETRIEVAL"),
+			Required: false,
+			Value:    RetrievalDense,
+		},
+		&cli.FloatFlag{
+			Name:     "hybrid-weight",
+			Usage:    "Weight (between 0 and 1) of the dense scores in hybrid retrieval, the keyword scores weighting the rest",
+			Sources:  cli.EnvVars("HYBRID_WEIGHT"),
+			Required: false,
+			Value:    0.7,
+		},
+		&cli.StringFlag{
+			Name:     "sparse-vector-name",
+			Usage:    "Name of the sparse vector holding the keywords of the chunks",
+			Sources:  cli.EnvVars("SPARSE_VECTOR_NAME"),
+			Required: false,
+			Value:    corpus.SparseVectorName,
+		},
+		&cli.StringSliceFlag{
+			Name:     "filter",
+			Usage:    "Payload filter applied to every search, as key=value or key!=value, alternative values separated by | (e.g. product=PKI, doc_type!=draft|obsolete)",
+			Sources:  cli.EnvVars("FILTERS"),
+			Required: false,
+		},
+		&cli.StringFlag{
+			Name:     "filters-file",
+			Usage:    ".json file listing the payload filters of the questionnaire (e.g. [\"framework=ISO27001\"]), combined with --filter",
+			Sources:  cli.EnvVars("FILTERS_FILE"),
+			Required: false,
+			Value:    "",
+		},
+		&cli.StringFlag{
+			Name:     "synonyms-file",
+			Usage:    ".json file mapping terms to their synonyms (e.g. {\"BCP\": [\"Business Continuity Plan\"]}), each synonym being searched as a variant of the question",
+			Sources:  cli.EnvVars("SYNONYMS_FILE"),
+			Required: false,
+			Value:    "",
+		},
+		&cli.IntFlag{
+			Name:     "query-rewrites",
+			Usage:    "Number of alternative phrasings of each question generated by the LLM and searched as variants, 0 to disable",
+			Sources:  cli.EnvVars("QUERY_REWRITES"),
+			Required: false,
+			Value:    0,
+		},
+		&cli.StringFlag{
+			Name:     "reranker",
+			Usage:    "Reranking of the snippets before building the prompt: none, cross-encoder (served at --reranker-url) or llm",
+			Sources:  cli.EnvVars("RERANKER"),
+			Required: false,
+			Value:    RerankerNone,
+		},
+		&cli.StringFlag{
+			Name:     "reranker-url",
+			Usage:    "URL of the cross-encoder rerank endpoint, taking {\"query\", \"texts\", \"raw_scores\"} and returning [{\"index\", \"score\"}], the scores being logits",
+			Sources:  cli.EnvVars("RERANKER_URL"),
+			Required: false,
+			Value:    "http://localhost:8080/rerank",
+		},
+		&cli.IntFlag{
+			Name:     "rerank-top-n",
+			Usage:    "Number of snippets kept after reranking, 0 to keep them all",
+			Sources:  cli.EnvVars("RERANK_TOP_N"),
+			Required: false,
+			Value:    5,
+		},
+		&cli.IntFlag{
+			Name:     "neighbor-chunks",
+			Usage:    "Number of chunks of the same source merged before and after each snippet, using their chunk_index payload field, 0 to disable",
+			Sources:  cli.EnvVars("NEIGHBOR_CHUNKS"),
+			Required: false,
+			Value:    0,
+		},
+		&cli.FloatFlag{
+			Name:     "dedup-threshold",
+			Usage:    "Word overlap (between 0 and 1) above which a snippet is dropped as a near-duplicate of a better one, 0 to disable",
+			Sources:  cli.EnvVars("DEDUP_THRESHOLD"),
+			Required: false,
+			Value:    0.9,
+		},
+		&cli.IntFlag{
+			Name:     "mmr-top-k",
+			Usage:    "Number of snippets selected by maximal marginal relevance, favoring distinct evidence and sources, 0 to disable",
+			Sources:  cli.EnvVars("MMR_TOP_K"),
+			Required: false,
+			Value:    0,
+		},
+		&cli.FloatFlag{
+			Name:     "mmr-lambda",
+			Usage:    "Trade-off (between 0 and 1) between relevance and diversity in maximal marginal relevance, 1 being pure relevance",
+			Sources:  cli.EnvVars("MMR_LAMBDA"),
+			Required: false,
+			Value:    0.7,
+		},
+		&cli.IntFlag{
+			Name:     "context-window",
+			Usage:    "Context window of the model in tokens, snippets not fitting being dropped, 0 to use --num-ctx, both 0 to disable",
+			Sources:  cli.EnvVars("CONTEXT_WINDOW"),
+			Required: false,
+			Value:    0,
+		},
+		&cli.IntFlag{
+			Name:     "answer-token-reserve",
+			Usage:    "Number of tokens of the context window reserved for the answer",
+			Sources:  cli.EnvVars("ANSWER_TOKEN_RESERVE"),
+			Required: false,
+			Value:    512,
+		},
+		&cli.IntFlag{
+			Name:     "max-hops",
+			Usage:    "Maximum number of follow-up searches proposed by the LLM when the snippets do not answer the question, 0 to disable",
+			Sources:  cli.EnvVars("MAX_HOPS"),
+			Required: false,
+			Value:    0,
+		},
+		&cli.BoolFlag{
+			Name:     "decompose",
+			Usage:    "Split the compound questions into sub-questions, answer each of them and compose a single answer",
+			Sources:  cli.EnvVars("DECOMPOSE"),
+			Required: false,
+			Value:    false,
+		},
+		&cli.StringFlag{
+			Name:     "follow-ups",
+			Usage:    "Follow-up questions like \"If yes, please describe\" are answered in the context of the previous question; when its answer rules them out they are either skipped as not applicable (skip) or answered and flagged (mark). ignore answers them independently",
+			Sources:  cli.EnvVars("FOLLOW_UPS"),
+			Required: false,
+			Value:    FollowUpsMark,
+		},
+		&cli.StringFlag{
+			Name:     "prompt-dir",
+			Usage:    "Directory containing the prompt templates (system.tmpl, question.tmpl) overriding the built-in ones",
+			Sources:  cli.EnvVars("PROMPT_DIR"),
+			Required: false,
+			Value:    "",
+		},
+		&cli.StringFlag{
+			Name:     "company-name",
+			Usage:    "Name of the company answering the questionnaire, available in the prompt templates",
+			Sources:  cli.EnvVars("COMPANY_NAME"),
+			Required: false,
+			Value:    "",
+		},
+		&cli.StringFlag{
+			Name:     "product",
+			Usage:    "Product the questionnaire is about, available in the prompt templates",
+			Sources:  cli.EnvVars("PRODUCT"),
+			Required: false,
+			Value:    "",
+		},
+		&cli.StringFlag{
+			Name:     "questionnaire-name",
+			Usage:    "Name of the questionnaire, available in the prompt templates (defaults to the source file name)",
+			Sources:  cli.EnvVars("QUESTIONNAIRE_NAME"),
+			Required: false,
+			Value:    "",
+		},
+		&cli.StringFlag{
+			Name:     "few-shot-file",
+			Usage:    ".json file containing example questions, snippets and answers shown to the LLM before the questions",
+			Sources:  cli.EnvVars("FEW_SHOT_FILE"),
+			Required: false,
+			Value:    "",
+		},
+		&cli.StringFlag{
+			Name:     "history",
+			Usage:    "Whether previous questions and answers are carried in the conversation of the next questions (isolate or carry)",
+			Sources:  cli.EnvVars("HISTORY"),
+			Required: false,
+			Value:    HistoryIsolate,
+		},
+		&cli.FloatFlag{
+			Name:     "confidence-threshold",
+			Usage:    "Answers with a confidence score (between 0 and 1) below this threshold are marked as needing review",
+			Sources:  cli.EnvVars("CONFIDENCE_THRESHOLD"),
+			Required: false,
+			Value:    0.6,
+		},
+		&cli.StringFlag{
+			Name:     "verify",
+			Usage:    "Groundedness verification of the answers against the snippets (none, llm or overlap)",
+			Sources:  cli.EnvVars("VERIFY"),
+			Required: false,
+			Value:    VerifyNone,
+		},
+		&cli.StringFlag{
+			Name:     "verify-action",
+			Usage:    "Action on answers failing the verification (downgrade or replace with \"No information available\")",
+			Sources:  cli.EnvVars("VERIFY_ACTION"),
+			Required: false,
+			Value:    VerifyActionDowngrade,
+		},
+		&cli.BoolFlag{
+			Name:     "structured",
+			Usage:    "Ask the LLM for structured JSON answers (verdict, answer, cited snippets and confidence)",
+			Sources:  cli.EnvVars("STRUCTURED"),
+			Required: false,
+			Value:    false,
+		},
+		&cli.IntFlag{
+			Name:     "structured-retries",
+			Usage:    "Number of retries when the LLM returns a malformed structured answer",
+			Sources:  cli.EnvVars("STRUCTURED_RETRIES"),
+			Required: false,
+			Value:    2,
+		},
+		&cli.IntFlag{
+			Name:     "max-lines",
+			Usage:    "Maximum number of lines of an answer, 0 to disable",
+			Sources:  cli.EnvVars("MAX_LINES"),
+			Required: false,
+			Value:    7,
+		},
+		&cli.IntFlag{
+			Name:     "max-characters",
+			Usage:    "Maximum number of characters of an answer, 0 to disable",
+			Sources:  cli.EnvVars("MAX_CHARACTERS"),
+			Required: false,
+			Value:    0,
+		},
+		&cli.BoolFlag{
+			Name:     "forbid-bare-verdict",
+			Usage:    "Reject answers made only of \"Yes\" or \"No\"",
+			Sources:  cli.EnvVars("FORBID_BARE_VERDICT"),
+			Required: false,
+			Value:    true,
+		},
+		&cli.StringSliceFlag{
+			Name:     "forbidden-phrases",
+			Usage:    "Phrases an answer must not contain",
+			Sources:  cli.EnvVars("FORBIDDEN_PHRASES"),
+			Required: false,
+			Value:    []string{"As an AI"},
+		},
+		&cli.StringFlag{
+			Name:     "required-language",
+			Usage:    "ISO 639-1 code of the language answers must be written in (en, fr, de, es, it), empty to disable",
+			Sources:  cli.EnvVars("REQUIRED_LANGUAGE"),
+			Required: false,
+			Value:    "",
+		},
+		&cli.StringFlag{
+			Name:     "answer-language",
+			Usage:    "ISO 639-1 code of the language every answer is written in (en, fr, de, es, it), empty to answer in the language detected in each question",
+			Sources:  cli.EnvVars("ANSWER_LANGUAGE"),
+			Required: false,
+			Value:    "",
+		},
+		&cli.StringFlag{
+			Name:     "corpus-language",
+			Usage:    "ISO 639-1 code of the language of the corpus, questions in another language being translated to search it, empty to disable",
+			Sources:  cli.EnvVars("CORPUS_LANGUAGE"),
+			Required: false,
+			Value:    language.English,
+		},
+		&cli.IntFlag{
+			Name:     "format-retries",
+			Usage:    "Number of times the LLM is re-prompted when an answer violates the format rules",
+			Sources:  cli.EnvVars("FORMAT_RETRIES"),
+			Required: false,
+			Value:    2,
+		},
 	},
 	Action: func(ctx context.Context, cmd *cli.Command) error {
-		return validateAndExecute(cmd)
+		return validateAndExecute(ctx, cmd)
 	},
 }
 
@@ -75,6 +467,153 @@ func ValidateFlags(cmd *cli.Command) error {
 	if !checkFileExtension(cmd.String("output-file"), ".csv") {
 		return fmt.Errorf("output-file must be a .csv file: %s", cmd.String("output-file"))
 	}
+	if baseline := cmd.String("baseline"); baseline != "" {
+		if !isValidFilePath(baseline) {
+			return fmt.Errorf("invalid baseline path: %s", baseline)
+		}
+		if !checkFileExtension(baseline, ".csv") {
+			return fmt.Errorf("baseline must be a .csv file: %s", baseline)
+		}
+	}
+	if similarity := cmd.Float("baseline-similarity"); similarity < 0 || similarity > 1 {
+		return fmt.Errorf("baseline-similarity must be between 0 and 1: %f", similarity)
+	}
+	if threshold := cmd.Float("confidence-threshold"); threshold < 0 || threshold > 1 {
+		return fmt.Errorf("confidence-threshold must be between 0 and 1: %f", threshold)
+	}
+	switch cmd.String("verify") {
+	case VerifyNone, VerifyLLM, VerifyOverlap:
+	default:
+		return fmt.Errorf("invalid verify mode: %s", cmd.String("verify"))
+	}
+	switch cmd.String("verify-action") {
+	case VerifyActionDowngrade, VerifyActionReplace:
+	default:
+		return fmt.Errorf("invalid verify-action: %s", cmd.String("verify-action"))
+	}
+	if cmd.Int("structured-retries") < 0 {
+		return fmt.Errorf("structured-retries must be positive: %d", cmd.Int("structured-retries"))
+	}
+	if cmd.Int("max-lines") < 0 || cmd.Int("max-characters") < 0 || cmd.Int("format-retries") < 0 {
+		return fmt.Errorf("max-lines, max-characters and format-retries must be positive")
+	}
+	switch cmd.String("retrieval") {
+	case RetrievalDense, RetrievalHybrid:
+	default:
+		return fmt.Errorf("invalid retrieval mode: %s", cmd.String("retrieval"))
+	}
+	if weight := cmd.Float("hybrid-weight"); weight < 0 || weight > 1 {
+		return fmt.Errorf("hybrid-weight must be between 0 and 1: %f", weight)
+	}
+	if filtersFile := cmd.String("filters-file"); filtersFile != "" {
+		if !isValidFilePath(filtersFile) {
+			return fmt.Errorf("invalid filters-file path: %s", filtersFile)
+		}
+		if !checkFileExtension(filtersFile, ".json") {
+			return fmt.Errorf("filters-file must be a .json file: %s", filtersFile)
+		}
+	}
+	if _, err := BuildFilter(cmd.StringSlice("filter")); err != nil {
+		return err
+	}
+	if synonymsFile := cmd.String("synonyms-file"); synonymsFile != "" {
+		if !isValidFilePath(synonymsFile) {
+			return fmt.Errorf("invalid synonyms-file path: %s", synonymsFile)
+		}
+		if !checkFileExtension(synonymsFile, ".json") {
+			return fmt.Errorf("synonyms-file must be a .json file: %s", synonymsFile)
+		}
+	}
+	if cmd.Int("neighbor-chunks") < 0 {
+		return fmt.Errorf("neighbor-chunks must be positive: %d", cmd.Int("neighbor-chunks"))
+	}
+	if dedupThreshold := cmd.Float("dedup-threshold"); dedupThreshold < 0 || dedupThreshold > 1 {
+		return fmt.Errorf("dedup-threshold must be between 0 and 1: %f", dedupThreshold)
+	}
+	if cmd.Int("mmr-top-k") < 0 {
+		return fmt.Errorf("mmr-top-k must be positive: %d", cmd.Int("mmr-top-k"))
+	}
+	if mmrLambda := cmd.Float("mmr-lambda"); mmrLambda < 0 || mmrLambda > 1 {
+		return fmt.Errorf("mmr-lambda must be between 0 and 1: %f", mmrLambda)
+	}
+	if cmd.Int("context-window") < 0 {
+		return fmt.Errorf("context-window must be positive: %d", cmd.Int("context-window"))
+	}
+	if cmd.Int("answer-token-reserve") < 0 {
+		return fmt.Errorf("answer-token-reserve must be positive: %d", cmd.Int("answer-token-reserve"))
+	}
+	switch cmd.String("follow-ups") {
+	case FollowUpsIgnore, FollowUpsSkip, FollowUpsMark:
+	default:
+		return fmt.Errorf("invalid follow-ups mode: %s", cmd.String("follow-ups"))
+	}
+	if cmd.Int("max-hops") < 0 {
+		return fmt.Errorf("max-hops must be positive: %d", cmd.Int("max-hops"))
+	}
+	if cmd.Int("query-rewrites") < 0 {
+		return fmt.Errorf("query-rewrites must be positive: %d", cmd.Int("query-rewrites"))
+	}
+	switch cmd.String("reranker") {
+	case RerankerNone, RerankerLLM:
+	case RerankerCrossEncoder:
+		if cmd.String("reranker-url") == "" {
+			return fmt.Errorf("reranker-url is required with the cross-encoder reranker")
+		}
+	default:
+		return fmt.Errorf("invalid reranker: %s", cmd.String("reranker"))
+	}
+	if cmd.Int("rerank-top-n") < 0 {
+		return fmt.Errorf("rerank-top-n must be positive: %d", cmd.Int("rerank-top-n"))
+	}
+	switch cmd.String("on-error") {
+	case OnErrorSkip, OnErrorAbort, OnErrorMark:
+	default:
+		return fmt.Errorf("invalid on-error policy: %s", cmd.String("on-error"))
+	}
+	switch cmd.String("history") {
+	case HistoryIsolate, HistoryCarry:
+	default:
+		return fmt.Errorf("invalid history mode: %s", cmd.String("history"))
+	}
+	if fewShotFile := cmd.String("few-shot-file"); fewShotFile != "" && !checkFileExtension(fewShotFile, ".json") {
+		return fmt.Errorf("few-shot-file must be a .json file: %s", fewShotFile)
+	}
+	if temperature := cmd.Float("temperature"); temperature < 0 {
+		return fmt.Errorf("temperature must be positive: %f", temperature)
+	}
+	if topP := cmd.Float("top-p"); cmd.IsSet("top-p") && (topP <= 0 || topP > 1) {
+		return fmt.Errorf("top-p must be in ]0, 1]: %f", topP)
+	}
+	if cmd.Bool("live-output") && !cmd.Bool("stream") {
+		return fmt.Errorf("live-output requires stream")
+	}
+	if cmd.Duration("llm-first-token-timeout") < 0 || cmd.Duration("llm-timeout") < 0 {
+		return fmt.Errorf("llm-first-token-timeout and llm-timeout must be positive")
+	}
+	if cmd.Int("retry-max-attempts") < 1 {
+		return fmt.Errorf("retry-max-attempts must be at least 1: %d", cmd.Int("retry-max-attempts"))
+	}
+	if cmd.Duration("retry-initial-backoff") < 0 || cmd.Duration("retry-max-backoff") < cmd.Duration("retry-initial-backoff") {
+		return fmt.Errorf("retry-initial-backoff must be positive and lower than retry-max-backoff")
+	}
+	if cmd.Int("circuit-breaker-threshold") < 0 {
+		return fmt.Errorf("circuit-breaker-threshold must be positive: %d", cmd.Int("circuit-breaker-threshold"))
+	}
+	if cmd.Int("num-ctx") < 0 || cmd.Int("num-predict") < 0 {
+		return fmt.Errorf("num-ctx and num-predict must be positive")
+	}
+	if lang := cmd.String("required-language"); lang != "" && !language.IsSupported(lang) {
+		return fmt.Errorf("unsupported required-language: %s", lang)
+	}
+	if lang := cmd.String("answer-language"); lang != "" && !language.IsSupported(lang) {
+		return fmt.Errorf("unsupported answer-language: %s", lang)
+	}
+	if answerLang, requiredLang := cmd.String("answer-language"), cmd.String("required-language"); answerLang != "" && requiredLang != "" && answerLang != requiredLang {
+		return fmt.Errorf("answer-language %s conflicts with required-language %s", answerLang, requiredLang)
+	}
+	if lang := cmd.String("corpus-language"); lang != "" && !language.IsSupported(lang) {
+		return fmt.Errorf("unsupported corpus-language: %s", lang)
+	}
 	return nil
 }
 
@@ -94,7 +633,7 @@ func checkFileExtension(path string, ext string) bool {
 	return path[len(path)-len(ext):] == ext
 }
 
-func validateAndExecute(cmd *cli.Command) error {
+func validateAndExecute(ctx context.Context, cmd *cli.Command) error {
 	// Validate global flags
 	if err := common.ValidateCommonFlags(cmd); err != nil {
 		return err
@@ -105,5 +644,5 @@ func validateAndExecute(cmd *cli.Command) error {
 		return err
 	}
 
-	return Answer(cmd)
+	return Answer(ctx, cmd)
 }
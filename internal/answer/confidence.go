@@ -0,0 +1,91 @@
+package answer
+
+import (
+	"compliance-form-filler/pkg/language"
+	"regexp"
+	"strings"
+
+	"github.com/qdrant/go-client/qdrant"
+)
+
+const (
+	// Weights of each signal in the confidence score, summing to 1
+	retrievalWeight = 0.5
+	agreementWeight = 0.2
+	modelWeight     = 0.3
+
+	// Snippets whose score is within this margin of the best one are considered as agreeing evidence
+	agreementMargin = 0.1
+	// Number of agreeing snippets needed to get the maximum agreement signal
+	agreementTarget = 3
+)
+
+// hedgingWords lists, for each supported language, the wording showing the model is not sure of its answer
+var hedgingWords = map[string][]string{
+	language.English: {"may", "might", "possibly", "probably", "likely", "unclear", "not clear", "appears to", "seems to", "it is possible"},
+	language.French:  {"peut-être", "possiblement", "probablement", "vraisemblablement", "semble", "semblent", "pas clair", "il est possible"},
+	language.German:  {"vielleicht", "möglicherweise", "wahrscheinlich", "vermutlich", "unklar", "scheint", "scheinen", "nicht klar"},
+	language.Spanish: {"quizás", "quizá", "posiblemente", "probablemente", "parece", "parecen", "no está claro", "es posible"},
+	language.Italian: {"forse", "possibilmente", "probabilmente", "sembra", "sembrano", "non è chiaro", "è possibile"},
+}
+
+// hedgingRegexp matches the hedging wording of any supported language, answers being written in the language of the question.
+// Word boundaries are spelled out since \b only knows ASCII letters.
+var hedgingRegexp = func() *regexp.Regexp {
+	var words []string
+	for _, list := range hedgingWords {
+		for _, word := range list {
+			words = append(words, regexp.QuoteMeta(word))
+		}
+	}
+	return regexp.MustCompile(`(?i)(?:^|[^\pL])(?:` + strings.Join(words, "|") + `)(?:[^\pL]|$)`)
+}()
+
+// ComputeConfidence returns a confidence score between 0 and 1 for an answer, derived from:
+//   - the retrieval score of the best snippet,
+//   - the evidence agreement, i.e. how many snippets score close to the best one,
+//   - the model signals: a "No information available" answer or hedging wording lower the confidence.
+func ComputeConfidence(points []*qdrant.ScoredPoint, answer string) float64 {
+	return combineConfidence(points, modelSignal(answer))
+}
+
+// ComputeStructuredConfidence works as ComputeConfidence, the model signal being capped by the confidence reported by the model
+func ComputeStructuredConfidence(points []*qdrant.ScoredPoint, answer StructuredAnswer) float64 {
+	return combineConfidence(points, min(modelSignal(answer.Answer), clamp(answer.Confidence)))
+}
+
+func modelSignal(answer string) float64 {
+	if !isApprovedAnswer(answer) {
+		return 0
+	}
+	if hedgingRegexp.MatchString(answer) {
+		return 0.5
+	}
+	return 1
+}
+
+func combineConfidence(points []*qdrant.ScoredPoint, model float64) float64 {
+	if len(points) == 0 {
+		return 0
+	}
+
+	bestScore := float32(0)
+	for _, point := range points {
+		bestScore = max(bestScore, point.Score)
+	}
+	retrieval := clamp(float64(bestScore))
+
+	agreeing := 0
+	for _, point := range points {
+		if bestScore-point.Score <= agreementMargin {
+			agreeing++
+		}
+	}
+	agreement := clamp(float64(agreeing) / agreementTarget)
+
+	return retrievalWeight*retrieval + agreementWeight*agreement + modelWeight*model
+}
+
+func clamp(value float64) float64 {
+	return min(max(value, 0), 1)
+}
@@ -0,0 +1,27 @@
+package answer
+
+import "testing"
+
+func TestModelSignal(t *testing.T) {
+	tests := []struct {
+		answer string
+		want   float64
+	}{
+		{answer: "Data is encrypted at rest with AES-256.", want: 1},
+		{answer: noInformationAnswer, want: 0},
+		{answer: "Data is probably encrypted at rest.", want: 0.5},
+		{answer: "Les données sont peut-être chiffrées.", want: 0.5},
+		{answer: "Die Daten werden vermutlich verschlüsselt.", want: 0.5},
+		{answer: "Quizás los datos están cifrados.", want: 0.5},
+		{answer: "I dati sono forse cifrati.", want: 0.5},
+		{answer: "Les données sont chiffrées au repos avec AES-256.", want: 1},
+		{answer: "Mayday procedures are documented.", want: 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.answer, func(t *testing.T) {
+			if got := modelSignal(tt.answer); got != tt.want {
+				t.Errorf("modelSignal(%q) = %f, want %f", tt.answer, got, tt.want)
+			}
+		})
+	}
+}
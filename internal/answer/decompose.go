@@ -0,0 +1,146 @@
+package answer
+
+import (
+	"compliance-form-filler/pkg/iohandler"
+	"compliance-form-filler/pkg/language"
+	"compliance-form-filler/pkg/llm"
+	"compliance-form-filler/pkg/logger"
+	"context"
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/qdrant/go-client/qdrant"
+)
+
+// compoundQuestionRegexp matches the questions likely made of several parts: a new question after a conjunction,
+// in any supported language, or a semicolon. Only these are sent to the LLM to be split.
+// Word boundaries are spelled out since \b only knows ASCII letters.
+var compoundQuestionRegexp = regexp.MustCompile(`(?i)((?:^|[^\pL])(?:` +
+	`(?:and|or|also)\s+(?:how|what|when|where|who|which|why|do|does|is|are|can|have|has)|` +
+	`(?:et|ou|aussi)\s+(?:comment|quel|quelle|quels|quelles|quand|où|qui|pourquoi|combien|est-ce)|` +
+	`(?:und|oder|auch)\s+(?:wie|was|wann|wo|wer|welche|welcher|welches|warum|gibt|haben|ist|sind|wird|werden)|` +
+	`(?:y|o|también)\s+(?:cómo|qué|cuándo|dónde|quién|cuál|cuáles|por\s+qué|tiene|tienen)|` +
+	`(?:e|o|anche)\s+(?:come|cosa|quando|dove|chi|quale|quali|perché)` +
+	`)(?:[^\pL]|$)|;)`)
+
+// composeSystemPrompt is the system message of the composition of the parts' answers, which are the only source allowed
+const composeSystemPrompt = "You are an assistant filling in compliance questionnaires. You combine the answers already given to the parts " +
+	"of a question into a single answer. Use only the information contained in these answers, without adding, " +
+	"softening or strengthening any statement, and keep the sources and details they mention."
+
+// decomposeQuestion splits a compound question into self-contained sub-questions.
+// Questions not looking compound, or that the LLM does not split, are returned as is.
+func (p *pipeline) decomposeQuestion(ctx context.Context, question string) ([]string, error) {
+	if strings.Count(question, "?") < 2 && !compoundQuestionRegexp.MatchString(question) {
+		return []string{question}, nil
+	}
+
+	decomposePrompt := "Split the following compliance questionnaire question into the independent sub-questions it asks, " +
+		"each one self-contained and answerable on its own. Do not split enumerations belonging to a single topic.\n" +
+		"Reply with one sub-question per line, and nothing else. If the question asks a single thing, reply with it unchanged.\n\n" +
+		"Question: " + question
+	response, err := p.llmClient.SendMessagesToLLM(ctx, []llm.Message{{Role: llm.RoleUser, Content: decomposePrompt}})
+	if err != nil {
+		return nil, fmt.Errorf("failed to send decomposition prompt to LLM: %w", err)
+	}
+
+	var subQuestions []string
+	for _, line := range strings.Split(response, "\n") {
+		if line = strings.TrimSpace(listMarkerRegexp.ReplaceAllString(line, "")); line != "" {
+			subQuestions = append(subQuestions, line)
+		}
+	}
+	subQuestions = uniqueStrings(subQuestions)
+	if len(subQuestions) < 2 {
+		return []string{question}, nil
+	}
+	return subQuestions, nil
+}
+
+// answerParts answers each sub-question separately, then asks the LLM to compose a single answer covering every part
+func (p *pipeline) answerParts(ctx context.Context, question string, subQuestions []string) (*iohandler.Result, error) {
+	result := &iohandler.Result{Question: question, Confidence: 1}
+	var parts strings.Builder
+	var unanswered, verdicts []string
+	var evidence []*qdrant.ScoredPoint
+	for index, subQuestion := range subQuestions {
+		logger.DefaultLogger.Info().Msgf("Answering part %d/%d: %s", index+1, len(subQuestions), subQuestion)
+		partResult, _, partSnippets, err := p.answerSingle(ctx, subQuestion)
+		if err != nil {
+			return nil, fmt.Errorf("failed to answer part %q: %w", subQuestion, err)
+		}
+		parts.WriteString(fmt.Sprintf("Part %d: %s\nAnswer: %s\n\n", index+1, subQuestion, partResult.Answer))
+
+		if !isApprovedAnswer(partResult.Answer) {
+			unanswered = append(unanswered, subQuestion)
+		}
+		if partResult.Verdict != "" {
+			verdicts = append(verdicts, partResult.Verdict)
+		}
+		// The combined answer is as weak as its weakest part
+		result.Confidence = min(result.Confidence, partResult.Confidence)
+		result.NeedsReview = result.NeedsReview || partResult.NeedsReview
+		result.Evidence = append(result.Evidence, partResult.Evidence...)
+		evidence = mergeSnippets(evidence, partSnippets)
+		for _, source := range partResult.CitedSources {
+			if !slices.Contains(result.CitedSources, source) {
+				result.CitedSources = append(result.CitedSources, source)
+			}
+		}
+		if partResult.Notes != "" {
+			result.Notes = appendNote(result.Notes, fmt.Sprintf("part %d: %s", index+1, partResult.Notes))
+		}
+	}
+	result.Verdict = combineVerdicts(verdicts)
+
+	if len(unanswered) == len(subQuestions) {
+		result.Answer = noInformationAnswer
+		return result, nil
+	}
+	if len(unanswered) > 0 {
+		result.NeedsReview = true
+		result.Notes = appendNote(result.Notes, fmt.Sprintf("no information for: %s", strings.Join(unanswered, "; ")))
+	}
+
+	composePrompt := fmt.Sprintf("The following compliance questionnaire question was answered part by part.\n"+
+		"Write a single answer to the whole question combining the answers of the parts, covering every part, "+
+		"without adding any information. For a part answered with \"%s\", state that no information is available for it.\n"+
+		"Reply only with the answer.\n\nQuestion: %s\n\n%s", noInformationAnswer, question, parts.String())
+	if lang := p.answerLanguage(); lang != "" && lang != language.English {
+		composePrompt += fmt.Sprintf("\nWrite the answer in %s.", language.Names[lang])
+	}
+	logger.DefaultLogger.Info().Msgf("Composing the answers of %d parts", len(subQuestions))
+	p.printAnswer("\n")
+	answer, err := p.answerClient.SendMessagesToLLM(ctx, []llm.Message{
+		{Role: llm.RoleSystem, Content: composeSystemPrompt},
+		{Role: llm.RoleUser, Content: composePrompt},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to send composition prompt to LLM: %w", err)
+	}
+	result.Answer = answer
+	if violations := p.answerValidator().Validate(answer); len(violations) > 0 {
+		result.NeedsReview = true
+		result.Notes = appendNote(result.Notes, fmt.Sprintf("invalid format: %s", strings.Join(violations, "; ")))
+	}
+	// The combined answer must be grounded in the snippets of all the parts
+	if err = p.verifyResult(ctx, result, evidence); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// combineVerdicts returns the verdict shared by every part, Partial when they differ
+func combineVerdicts(verdicts []string) string {
+	if len(verdicts) == 0 {
+		return ""
+	}
+	for _, verdict := range verdicts[1:] {
+		if verdict != verdicts[0] {
+			return VerdictPartial
+		}
+	}
+	return verdicts[0]
+}
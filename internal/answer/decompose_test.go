@@ -0,0 +1,29 @@
+package answer
+
+import "testing"
+
+func TestCompoundQuestionRegexp(t *testing.T) {
+	tests := []struct {
+		question string
+		want     bool
+	}{
+		{question: "Is data encrypted at rest and how are the keys rotated?", want: true},
+		{question: "Do you have a DPO; who is it?", want: true},
+		{question: "Is data encrypted at rest and in transit?", want: false},
+		{question: "Les données sont-elles chiffrées et comment les clés sont-elles renouvelées ?", want: true},
+		{question: "Les données sont-elles chiffrées au repos et en transit ?", want: false},
+		{question: "Gibt es einen Notfallplan und wie oft wird er getestet?", want: true},
+		{question: "Werden Daten verschlüsselt gespeichert und übertragen?", want: false},
+		{question: "¿Se cifran los datos y cómo se rotan las claves?", want: true},
+		{question: "¿Se cifran los datos en reposo y en tránsito?", want: false},
+		{question: "I dati sono cifrati e come vengono ruotate le chiavi?", want: true},
+		{question: "I dati sono cifrati a riposo e in transito?", want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.question, func(t *testing.T) {
+			if got := compoundQuestionRegexp.MatchString(tt.question); got != tt.want {
+				t.Errorf("compoundQuestionRegexp.MatchString(%q) = %t, want %t", tt.question, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,104 @@
+package answer
+
+import (
+	"compliance-form-filler/pkg/logger"
+
+	"github.com/qdrant/go-client/qdrant"
+)
+
+// sameSourceSimilarity is the minimum similarity of two snippets of the same source in MMR selection,
+// so that snippets of other sources are preferred when they are about as relevant
+const sameSourceSimilarity = 0.5
+
+// deduplicateSnippets drops the snippets whose text is nearly identical to the one of a better snippet,
+// e.g. the same chunk ingested from several copies of a policy. A threshold of 0 disables the deduplication.
+func deduplicateSnippets(points []*qdrant.ScoredPoint, threshold float64) []*qdrant.ScoredPoint {
+	if threshold <= 0 {
+		return points
+	}
+	var kept []*qdrant.ScoredPoint
+	var keptWords []map[string]bool
+	for _, point := range points {
+		words := wordSet(point)
+		duplicate := false
+		for index, known := range keptWords {
+			if jaccard(words, known) >= threshold {
+				logger.DefaultLogger.Debug().Msgf("Snippet of %s is a near-duplicate of the snippet of %s, dropped",
+					point.Payload[qdrantSourceFieldName].GetStringValue(), kept[index].Payload[qdrantSourceFieldName].GetStringValue())
+				duplicate = true
+				break
+			}
+		}
+		if !duplicate {
+			kept = append(kept, point)
+			keptWords = append(keptWords, words)
+		}
+	}
+	return kept
+}
+
+// selectDiverseSnippets keeps topK snippets by maximal marginal relevance: each pick maximizes
+// lambda * score - (1 - lambda) * similarity with the snippets already picked.
+// Similarity is the word overlap of the texts, raised for snippets of the same source.
+func selectDiverseSnippets(points []*qdrant.ScoredPoint, topK int, lambda float64) []*qdrant.ScoredPoint {
+	if topK <= 0 || len(points) <= topK {
+		return points
+	}
+	words := make([]map[string]bool, len(points))
+	for index, point := range points {
+		words[index] = wordSet(point)
+	}
+
+	picked := make([]int, 0, topK)
+	used := make([]bool, len(points))
+	for len(picked) < topK {
+		best, bestValue := -1, 0.0
+		for candidate, point := range points {
+			if used[candidate] {
+				continue
+			}
+			redundancy := 0.0
+			for _, selected := range picked {
+				similarity := jaccard(words[candidate], words[selected])
+				if point.Payload[qdrantSourceFieldName].GetStringValue() == points[selected].Payload[qdrantSourceFieldName].GetStringValue() {
+					similarity = max(similarity, sameSourceSimilarity)
+				}
+				redundancy = max(redundancy, similarity)
+			}
+			value := lambda*float64(point.Score) - (1-lambda)*redundancy
+			if best < 0 || value > bestValue {
+				best, bestValue = candidate, value
+			}
+		}
+		used[best] = true
+		picked = append(picked, best)
+	}
+
+	selected := make([]*qdrant.ScoredPoint, 0, topK)
+	for _, index := range picked {
+		selected = append(selected, points[index])
+	}
+	return selected
+}
+
+func wordSet(point *qdrant.ScoredPoint) map[string]bool {
+	words := make(map[string]bool)
+	for _, word := range contentWords(point.Payload[qdrantTextFieldName].GetStringValue()) {
+		words[word] = true
+	}
+	return words
+}
+
+// jaccard returns the share of the words of both sets found in both of them
+func jaccard(a, b map[string]bool) float64 {
+	if len(a) == 0 && len(b) == 0 {
+		return 1
+	}
+	common := 0
+	for word := range a {
+		if b[word] {
+			common++
+		}
+	}
+	return float64(common) / float64(len(a)+len(b)-common)
+}
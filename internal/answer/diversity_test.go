@@ -0,0 +1,167 @@
+package answer
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/qdrant/go-client/qdrant"
+)
+
+const (
+	encryptionText       = "Backups are encrypted daily using AES keys rotated yearly"
+	encryptionCopyText   = "Backups are encrypted daily using AES keys rotated yearly offsite"
+	accessReviewText     = "Access reviews are performed quarterly and managers approve changes"
+	incidentResponseText = "The incident response plan is tested annually with tabletop exercises"
+	vendorText           = "Vendors sign confidentiality agreements before onboarding"
+)
+
+func snippet(id uint64, score float32, source, text string) *qdrant.ScoredPoint {
+	return &qdrant.ScoredPoint{
+		Id:    qdrant.NewIDNum(id),
+		Score: score,
+		Payload: map[string]*qdrant.Value{
+			qdrantSourceFieldName: qdrant.NewValueString(source),
+			qdrantTextFieldName:   qdrant.NewValueString(text),
+		},
+	}
+}
+
+func snippetIDs(points []*qdrant.ScoredPoint) []uint64 {
+	var ids []uint64
+	for _, point := range points {
+		ids = append(ids, point.GetId().GetNum())
+	}
+	return ids
+}
+
+func TestDeduplicateSnippets(t *testing.T) {
+	// The copy shares 8 of its 9 content words with the original, a Jaccard similarity of 0.89
+	points := []*qdrant.ScoredPoint{
+		snippet(1, 0.9, "policy.pdf", encryptionText),
+		snippet(2, 0.8, "policy-copy.pdf", encryptionCopyText),
+		snippet(3, 0.7, "access.pdf", accessReviewText),
+	}
+	tests := []struct {
+		name      string
+		threshold float64
+		want      []uint64
+	}{
+		{name: "disabled", threshold: 0, want: []uint64{1, 2, 3}},
+		{name: "near-duplicate dropped", threshold: 0.85, want: []uint64{1, 3}},
+		{name: "similarity below threshold", threshold: 0.9, want: []uint64{1, 2, 3}},
+		{name: "only identical texts dropped", threshold: 1, want: []uint64{1, 2, 3}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := snippetIDs(deduplicateSnippets(points, tt.threshold)); !slices.Equal(got, tt.want) {
+				t.Errorf("deduplicateSnippets() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSelectDiverseSnippets(t *testing.T) {
+	tests := []struct {
+		name   string
+		points []*qdrant.ScoredPoint
+		topK   int
+		lambda float64
+		want   []uint64
+	}{
+		{
+			name:   "disabled",
+			points: []*qdrant.ScoredPoint{snippet(1, 0.9, "a.pdf", encryptionText), snippet(2, 0.8, "b.pdf", encryptionCopyText)},
+			topK:   0,
+			lambda: 0.7,
+			want:   []uint64{1, 2},
+		},
+		{
+			name:   "fewer snippets than topK",
+			points: []*qdrant.ScoredPoint{snippet(1, 0.9, "a.pdf", encryptionText), snippet(2, 0.8, "b.pdf", encryptionCopyText)},
+			topK:   3,
+			lambda: 0.7,
+			want:   []uint64{1, 2},
+		},
+		{
+			name: "lambda 1 picks by relevance only",
+			points: []*qdrant.ScoredPoint{
+				snippet(1, 0.9, "a.pdf", encryptionText),
+				snippet(2, 0.85, "b.pdf", encryptionCopyText),
+				snippet(3, 0.6, "c.pdf", accessReviewText),
+				snippet(4, 0.8, "a.pdf", incidentResponseText),
+			},
+			topK:   3,
+			lambda: 1,
+			want:   []uint64{1, 2, 4},
+		},
+		{
+			name: "lambda 0 picks by diversity only",
+			points: []*qdrant.ScoredPoint{
+				snippet(1, 0.9, "a.pdf", encryptionText),
+				snippet(2, 0.85, "b.pdf", encryptionCopyText),
+				snippet(3, 0.6, "c.pdf", accessReviewText),
+				snippet(4, 0.8, "a.pdf", incidentResponseText),
+			},
+			topK:   3,
+			lambda: 0,
+			want:   []uint64{1, 3, 4},
+		},
+		{
+			name: "same source penalized",
+			points: []*qdrant.ScoredPoint{
+				snippet(1, 0.9, "a.pdf", encryptionText),
+				snippet(2, 0.8, "a.pdf", incidentResponseText),
+				snippet(3, 0.75, "d.pdf", vendorText),
+			},
+			topK:   2,
+			lambda: 0.7,
+			want:   []uint64{1, 3},
+		},
+		{
+			name: "relevance wins over a weak same source penalty",
+			points: []*qdrant.ScoredPoint{
+				snippet(1, 0.9, "a.pdf", encryptionText),
+				snippet(2, 0.8, "a.pdf", incidentResponseText),
+				snippet(3, 0.4, "d.pdf", vendorText),
+			},
+			topK:   2,
+			lambda: 0.7,
+			want:   []uint64{1, 2},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := snippetIDs(selectDiverseSnippets(tt.points, tt.topK, tt.lambda)); !slices.Equal(got, tt.want) {
+				t.Errorf("selectDiverseSnippets() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestJaccard(t *testing.T) {
+	set := func(words ...string) map[string]bool {
+		result := make(map[string]bool)
+		for _, word := range words {
+			result[word] = true
+		}
+		return result
+	}
+	tests := []struct {
+		name string
+		a, b map[string]bool
+		want float64
+	}{
+		{name: "identical", a: set("backup", "encrypted"), b: set("backup", "encrypted"), want: 1},
+		{name: "disjoint", a: set("backup"), b: set("access"), want: 0},
+		{name: "overlap", a: set("backup", "encrypted", "daily"), b: set("backup", "encrypted", "weekly"), want: 0.5},
+		{name: "both empty", a: set(), b: set(), want: 1},
+		{name: "one empty", a: set("backup"), b: set(), want: 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := jaccard(tt.a, tt.b); got != tt.want {
+				t.Errorf("jaccard() = %f, want %f", got, tt.want)
+			}
+		})
+	}
+}
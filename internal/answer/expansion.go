@@ -0,0 +1,144 @@
+package answer
+
+import (
+	"compliance-form-filler/pkg/llm"
+	"compliance-form-filler/pkg/logger"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/qdrant/go-client/qdrant"
+)
+
+// listMarkerRegexp matches the numbering or bullet at the start of a line generated by the LLM
+var listMarkerRegexp = regexp.MustCompile(`^\s*(\d+[.)]|[-*•])\s*`)
+
+// Synonyms maps terms, typically acronyms, to their alternative phrasings
+type Synonyms map[string][]string
+
+// LoadSynonyms reads the synonym dictionary from a JSON file like {"BCP": ["Business Continuity Plan"]}
+func LoadSynonyms(filePath string) (Synonyms, error) {
+	data, err := os.ReadFile(filePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read synonyms file: %w", err)
+	}
+	var synonyms Synonyms
+	if err := json.Unmarshal(data, &synonyms); err != nil {
+		return nil, fmt.Errorf("failed to parse synonyms file: %w", err)
+	}
+	return synonyms, nil
+}
+
+// Expand returns the variants of the question obtained by replacing each known term by its synonyms
+func (s Synonyms) Expand(question string) []string {
+	terms := make([]string, 0, len(s))
+	for term := range s {
+		terms = append(terms, term)
+	}
+	// Sort the terms to get the variants in a deterministic order
+	sort.Strings(terms)
+
+	var variants []string
+	for _, term := range terms {
+		termRegexp := regexp.MustCompile(`(?i)\b` + regexp.QuoteMeta(term) + `\b`)
+		if !termRegexp.MatchString(question) {
+			continue
+		}
+		for _, synonym := range s[term] {
+			variants = append(variants, termRegexp.ReplaceAllLiteralString(question, synonym))
+		}
+	}
+	return variants
+}
+
+// queryVariants returns the question followed by its alternative phrasings, from the synonyms and the LLM
+func (p *pipeline) queryVariants(ctx context.Context, question string) ([]string, error) {
+	variants := []string{question}
+	if p.synonyms != nil {
+		variants = append(variants, p.synonyms.Expand(question)...)
+	}
+	if p.queryRewrites > 0 {
+		rewrites, err := p.rewriteQuery(ctx, question)
+		if err != nil {
+			return nil, err
+		}
+		variants = append(variants, rewrites...)
+	}
+	return uniqueStrings(variants), nil
+}
+
+// rewriteQuery asks the LLM for alternative phrasings of the question, as they would appear in a policy
+func (p *pipeline) rewriteQuery(ctx context.Context, question string) ([]string, error) {
+	rewritePrompt := fmt.Sprintf("Rewrite the following compliance questionnaire question in %d different ways, "+
+		"using the wording a company policy or procedure would use, and expanding every acronym.\n"+
+		"Reply with one rewriting per line, and nothing else.\n\nQuestion: %s", p.queryRewrites, question)
+	response, err := p.llmClient.SendMessagesToLLM(ctx, []llm.Message{{Role: llm.RoleUser, Content: rewritePrompt}})
+	if err != nil {
+		return nil, fmt.Errorf("failed to send rewriting prompt to LLM: %w", err)
+	}
+
+	var rewrites []string
+	for _, line := range strings.Split(response, "\n") {
+		line = strings.TrimSpace(listMarkerRegexp.ReplaceAllString(line, ""))
+		if line != "" {
+			rewrites = append(rewrites, line)
+		}
+		if len(rewrites) == p.queryRewrites {
+			break
+		}
+	}
+	return rewrites, nil
+}
+
+// retrieveVariants embeds and searches each variant of the question, and fuses the results
+// keeping for each snippet its best score among the variants.
+func (p *pipeline) retrieveVariants(ctx context.Context, variants []string) ([]*qdrant.ScoredPoint, error) {
+	fused := make(map[string]*qdrant.ScoredPoint)
+	for _, variant := range variants {
+		logger.DefaultLogger.Info().Msgf("Embedding question: %s", variant)
+		vector, err := p.embeddingClient.Embed(ctx, variant)
+		if err != nil {
+			return nil, fmt.Errorf("failed to vectorize question: %w", err)
+		}
+
+		logger.DefaultLogger.Info().Msgf("Searching in Qdrant for question: %s", variant)
+		points, err := p.retrieve(ctx, variant, vector)
+		if err != nil {
+			return nil, fmt.Errorf("qdrant search failed: %w", err)
+		}
+		for _, point := range points {
+			key := point.GetId().String()
+			if existing, ok := fused[key]; !ok || point.Score > existing.Score {
+				fused[key] = point
+			}
+		}
+	}
+
+	points := make([]*qdrant.ScoredPoint, 0, len(fused))
+	for _, point := range fused {
+		points = append(points, point)
+	}
+	sort.SliceStable(points, func(i, j int) bool { return points[i].Score > points[j].Score })
+	if len(points) > searchLimit {
+		points = points[:searchLimit]
+	}
+	return points, nil
+}
+
+func uniqueStrings(values []string) []string {
+	seen := make(map[string]bool, len(values))
+	unique := values[:0]
+	for _, value := range values {
+		key := strings.ToLower(strings.TrimSpace(value))
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+		unique = append(unique, value)
+	}
+	return unique
+}
@@ -0,0 +1,66 @@
+package answer
+
+import (
+	"compliance-form-filler/pkg/llm"
+	"compliance-form-filler/pkg/prompt"
+	"encoding/json"
+	"fmt"
+	"os"
+)
+
+// FewShotExample is an example of question and expected answer shown to the LLM before the questions
+type FewShotExample struct {
+	Question string           `json:"question"`
+	Snippets []FewShotSnippet `json:"snippets"`
+	Answer   string           `json:"answer"`
+}
+
+// FewShotSnippet is a snippet given along a few-shot example question
+type FewShotSnippet struct {
+	Text   string  `json:"text"`
+	Score  float32 `json:"score"`
+	Source string  `json:"source"`
+}
+
+// LoadFewShotExamples reads the examples from a JSON file containing a list of examples
+func LoadFewShotExamples(filePath string) ([]FewShotExample, error) {
+	data, err := os.ReadFile(filePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read few-shot file: %w", err)
+	}
+	var examples []FewShotExample
+	if err := json.Unmarshal(data, &examples); err != nil {
+		return nil, fmt.Errorf("failed to parse few-shot file: %w", err)
+	}
+	for index, example := range examples {
+		if example.Question == "" || example.Answer == "" {
+			return nil, fmt.Errorf("few-shot example %d must have a question and an answer", index+1)
+		}
+	}
+	return examples, nil
+}
+
+// fewShotMessages renders the examples as pairs of user and assistant messages, using the question template
+func fewShotMessages(templates *prompt.Templates, vars prompt.Variables, examples []FewShotExample) ([]llm.Message, error) {
+	var messages []llm.Message
+	for _, example := range examples {
+		data := prompt.QuestionData{Variables: vars, Question: example.Question}
+		for index, snippet := range example.Snippets {
+			data.Snippets = append(data.Snippets, prompt.Snippet{
+				Index:  index + 1,
+				Text:   snippet.Text,
+				Score:  snippet.Score,
+				Source: snippet.Source,
+			})
+		}
+		content, err := templates.Question(data)
+		if err != nil {
+			return nil, err
+		}
+		messages = append(messages,
+			llm.Message{Role: llm.RoleUser, Content: content},
+			llm.Message{Role: llm.RoleAssistant, Content: example.Answer},
+		)
+	}
+	return messages, nil
+}
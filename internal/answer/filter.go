@@ -0,0 +1,73 @@
+package answer
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/qdrant/go-client/qdrant"
+)
+
+// filterValueSeparator separates the alternative values of a filter condition, e.g. "doc_type!=draft|obsolete"
+const filterValueSeparator = "|"
+
+// LoadFilterConditions reads the filter conditions of a questionnaire from a JSON file like ["product=PKI", "doc_type!=draft"]
+func LoadFilterConditions(filePath string) ([]string, error) {
+	data, err := os.ReadFile(filePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read filters file: %w", err)
+	}
+	var conditions []string
+	if err := json.Unmarshal(data, &conditions); err != nil {
+		return nil, fmt.Errorf("failed to parse filters file: %w", err)
+	}
+	return conditions, nil
+}
+
+// BuildFilter turns conditions like "product=PKI" or "doc_type!=draft|obsolete" into a Qdrant payload filter.
+// A chunk must match every "=" condition, on any of its values, and none of the "!=" conditions.
+// It returns nil when there is no condition.
+func BuildFilter(conditions []string) (*qdrant.Filter, error) {
+	if len(conditions) == 0 {
+		return nil, nil
+	}
+	filter := &qdrant.Filter{}
+	for _, condition := range conditions {
+		key, values, negated, err := parseFilterCondition(condition)
+		if err != nil {
+			return nil, err
+		}
+		match := qdrant.NewMatchKeywords(key, values...)
+		if len(values) == 1 {
+			match = qdrant.NewMatch(key, values[0])
+		}
+		if negated {
+			filter.MustNot = append(filter.MustNot, match)
+		} else {
+			filter.Must = append(filter.Must, match)
+		}
+	}
+	return filter, nil
+}
+
+func parseFilterCondition(condition string) (key string, values []string, negated bool, err error) {
+	key, value, found := strings.Cut(condition, "=")
+	if !found {
+		return "", nil, false, fmt.Errorf("invalid filter %q, expected key=value or key!=value", condition)
+	}
+	if strings.HasSuffix(key, "!") {
+		key = strings.TrimSuffix(key, "!")
+		negated = true
+	}
+	key = strings.TrimSpace(key)
+	for _, v := range strings.Split(value, filterValueSeparator) {
+		if v = strings.TrimSpace(v); v != "" {
+			values = append(values, v)
+		}
+	}
+	if key == "" || len(values) == 0 {
+		return "", nil, false, fmt.Errorf("invalid filter %q, expected key=value or key!=value", condition)
+	}
+	return key, values, negated, nil
+}
@@ -0,0 +1,99 @@
+package answer
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestParseFilterCondition(t *testing.T) {
+	tests := []struct {
+		condition   string
+		wantKey     string
+		wantValues  []string
+		wantNegated bool
+		wantErr     bool
+	}{
+		{condition: "product=PKI", wantKey: "product", wantValues: []string{"PKI"}},
+		{condition: " framework = ISO 27001 | SOC 2 ", wantKey: "framework", wantValues: []string{"ISO 27001", "SOC 2"}},
+		{condition: "doc_type!=draft|obsolete", wantKey: "doc_type", wantValues: []string{"draft", "obsolete"}, wantNegated: true},
+		{condition: "product=PKI||", wantKey: "product", wantValues: []string{"PKI"}},
+		{condition: "version=a=b", wantKey: "version", wantValues: []string{"a=b"}},
+		{condition: "product", wantErr: true},
+		{condition: "=PKI", wantErr: true},
+		{condition: "!=PKI", wantErr: true},
+		{condition: "product=", wantErr: true},
+		{condition: "product= | ", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.condition, func(t *testing.T) {
+			key, values, negated, err := parseFilterCondition(tt.condition)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseFilterCondition() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if key != tt.wantKey || !slices.Equal(values, tt.wantValues) || negated != tt.wantNegated {
+				t.Errorf("parseFilterCondition() = %q, %v, %t, want %q, %v, %t", key, values, negated, tt.wantKey, tt.wantValues, tt.wantNegated)
+			}
+		})
+	}
+}
+
+func TestBuildFilter(t *testing.T) {
+	tests := []struct {
+		name        string
+		conditions  []string
+		wantNil     bool
+		wantMust    []string
+		wantMustNot []string
+		wantErr     bool
+	}{
+		{name: "no condition", wantNil: true},
+		{name: "single value", conditions: []string{"product=PKI"}, wantMust: []string{"product"}},
+		{
+			name:        "must and must not",
+			conditions:  []string{"framework=ISO 27001|SOC 2", "doc_type!=draft"},
+			wantMust:    []string{"framework"},
+			wantMustNot: []string{"doc_type"},
+		},
+		{name: "invalid condition", conditions: []string{"product=PKI", "doc_type"}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			filter, err := BuildFilter(tt.conditions)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("BuildFilter() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if (filter == nil) != tt.wantNil {
+				t.Fatalf("BuildFilter() = %v, want nil %t", filter, tt.wantNil)
+			}
+			if filter == nil {
+				return
+			}
+			var must, mustNot []string
+			for _, condition := range filter.Must {
+				must = append(must, condition.GetField().GetKey())
+			}
+			for _, condition := range filter.MustNot {
+				mustNot = append(mustNot, condition.GetField().GetKey())
+			}
+			if !slices.Equal(must, tt.wantMust) || !slices.Equal(mustNot, tt.wantMustNot) {
+				t.Errorf("BuildFilter() keys = %v / %v, want %v / %v", must, mustNot, tt.wantMust, tt.wantMustNot)
+			}
+		})
+	}
+}
+
+func TestBuildFilterMatch(t *testing.T) {
+	filter, err := BuildFilter([]string{"product=PKI", "framework=ISO 27001|SOC 2"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := filter.Must[0].GetField().GetMatch().GetKeyword(); got != "PKI" {
+		t.Errorf("single value match = %q, want %q", got, "PKI")
+	}
+	if got := filter.Must[1].GetField().GetMatch().GetKeywords().GetStrings(); !slices.Equal(got, []string{"ISO 27001", "SOC 2"}) {
+		t.Errorf("multiple values match = %v, want %v", got, []string{"ISO 27001", "SOC 2"})
+	}
+}
@@ -0,0 +1,145 @@
+package answer
+
+import (
+	"compliance-form-filler/pkg/iohandler"
+	"fmt"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+)
+
+// Handling of the follow-up questions whose condition does not match the answer of their parent
+const (
+	// FollowUpsIgnore answers every question independently
+	FollowUpsIgnore = "ignore"
+	// FollowUpsSkip does not answer the follow-up, marking it as not applicable
+	FollowUpsSkip = "skip"
+	// FollowUpsMark answers the follow-up, flagging it for review
+	FollowUpsMark = "mark"
+)
+
+// notApplicableAnswer is the answer of the follow-up questions skipped because of the answer of their parent
+const notApplicableAnswer = "N/A"
+
+// followUpConditions maps the conditions opening a follow-up question, in each supported language,
+// to the verdict of the parent they apply to
+var followUpConditions = map[string]string{
+	"if yes": VerdictYes, "if so": VerdictYes, "if no": VerdictNo, "if not": VerdictNo,
+	"si oui": VerdictYes, "si c'est le cas": VerdictYes, "dans l'affirmative": VerdictYes,
+	"si non": VerdictNo, "si ce n'est pas le cas": VerdictNo, "dans la négative": VerdictNo,
+	"wenn ja": VerdictYes, "falls ja": VerdictYes, "wenn nein": VerdictNo, "falls nein": VerdictNo, "wenn nicht": VerdictNo, "falls nicht": VerdictNo,
+	"si sí": VerdictYes, "si es así": VerdictYes, "en caso afirmativo": VerdictYes, "si no": VerdictNo, "en caso negativo": VerdictNo,
+	"se sì": VerdictYes, "in caso affermativo": VerdictYes, "se no": VerdictNo, "se non": VerdictNo, "in caso negativo": VerdictNo,
+}
+
+// referringFollowUps match, in each supported language, the questions referring to the previous one like "Please describe it"
+var referringFollowUps = []string{
+	`(?:please\s+)?(?:describe|explain|specify|provide|list|detail)\s+(?:it|them|this|these|those)`,
+	`(?:veuillez\s+|merci\s+de\s+)?(?:le|la|les|l['’])\s*(?:décrire|expliquer|préciser|détailler|lister)`,
+	`(?:décrivez|expliquez|précisez|détaillez|listez)-(?:le|la|les)`,
+	`(?:bitte\s+)?(?:beschreiben|erläutern|erklären|nennen)\s+sie\s+(?:bitte\s+)?(?:es|dies|diese|diesen)`,
+	`(?:por\s+favor,?\s+)?(?:descríba|explíque|detálle|especifíque)l[oa]s?`,
+	`(?:si\s+prega\s+di\s+|per\s+favore,?\s+)?(?:descriver|spiegar|specificar|elencar|dettagliar)(?:lo|la|li|le)`,
+}
+
+// yesWords are the answers starting with a yes in each supported language, the others matched by polarityRegexp being a no
+var yesWords = []string{"yes", "oui", "ja", "sí", "sì"}
+
+var (
+	// followUpRegexp matches the questions depending on the previous one, either conditional like "If yes, ..."
+	// or referring to it like "Please describe it", capturing their condition if any.
+	// Word boundaries are spelled out since \b only knows ASCII letters.
+	followUpRegexp = func() *regexp.Regexp {
+		var conditions []string
+		for condition := range followUpConditions {
+			conditions = append(conditions, conditionPattern(condition))
+		}
+		// Longest first, so that "si ce n'est pas le cas" is not read as "si c..."
+		sort.Slice(conditions, func(i, j int) bool { return len(conditions[i]) > len(conditions[j]) })
+		return regexp.MustCompile(`(?i)^[^\pL]*(?:(` + strings.Join(conditions, "|") + `)|` + strings.Join(referringFollowUps, "|") + `)(?:[^\pL]|$)`)
+	}()
+	// polarityRegexp matches the answers starting with a yes or a no
+	polarityRegexp = regexp.MustCompile(`(?i)^[^\pL]*(yes|no|oui|non|ja|nein|sí|sì)(?:[^\pL]|$)`)
+)
+
+// conditionPattern turns a condition like "si c'est le cas" into a pattern accepting any spacing and apostrophe
+func conditionPattern(condition string) string {
+	var words []string
+	for _, word := range strings.Fields(condition) {
+		words = append(words, strings.ReplaceAll(regexp.QuoteMeta(word), "'", "['’]"))
+	}
+	return strings.Join(words, `\s+`)
+}
+
+// followUpCondition tells whether the question is a follow-up of the previous one, and the verdict of the parent
+// it applies to: Yes for "If yes, ...", No for "If no, ...", empty when unconditional.
+func followUpCondition(question string) (bool, string) {
+	match := followUpRegexp.FindStringSubmatch(question)
+	if match == nil {
+		return false, ""
+	}
+	condition := strings.Join(strings.Fields(strings.ReplaceAll(strings.ToLower(match[1]), "’", "'")), " ")
+	return true, followUpConditions[condition]
+}
+
+// answerPolarity returns Yes or No when the answer clearly is one of them, empty otherwise
+func answerPolarity(result *iohandler.Result) string {
+	if result.Verdict == VerdictYes || result.Verdict == VerdictNo {
+		return result.Verdict
+	}
+	answer := result.Answer
+	if len(result.Selected) == 1 {
+		answer = result.Selected[0]
+	}
+	// "No information available" is no answer at all
+	if !isApprovedAnswer(answer) {
+		return ""
+	}
+	match := polarityRegexp.FindStringSubmatch(answer)
+	if match == nil {
+		return ""
+	}
+	if slices.Contains(yesWords, strings.ToLower(match[1])) {
+		return VerdictYes
+	}
+	return VerdictNo
+}
+
+// conditionMismatch tells whether the parent answer rules the follow-up out, e.g. "If yes, ..." after a "No"
+func conditionMismatch(condition string, parent *iohandler.Result) bool {
+	if condition == "" || parent == nil {
+		return false
+	}
+	polarity := answerPolarity(parent)
+	return polarity != "" && polarity != condition
+}
+
+// contextualizeQuestion attaches the parent question to the follow-up, which is meaningless alone
+func contextualizeQuestion(question, parentQuestion string) string {
+	return fmt.Sprintf("%s (follow-up of the question: %s)", question, parentQuestion)
+}
+
+// parentAnswerContext returns the answer of the parent given to the LLM along with the follow-up, empty when unanswered.
+// It is kept out of the retrieval query, so that the search is not drawn towards the snippets of the parent.
+func parentAnswerContext(parent *iohandler.Result) string {
+	if parent == nil || !isApprovedAnswer(parent.Answer) {
+		return ""
+	}
+	return fmt.Sprintf("The previous question was answered: %s", parent.Answer)
+}
+
+// notApplicableResult is the result of a follow-up skipped because of the answer of its parent
+func notApplicableResult(question iohandler.Question, parentQuestion string, parent *iohandler.Result) iohandler.Result {
+	return iohandler.Result{
+		Section:    question.Section,
+		Question:   question.Text,
+		Type:       question.Type,
+		Options:    question.Options,
+		Language:   question.Language,
+		Answer:     notApplicableAnswer,
+		Status:     iohandler.StatusNotApplicable,
+		Confidence: 1,
+		Notes:      fmt.Sprintf("not applicable, the previous question was answered %s: %s", answerPolarity(parent), parentQuestion),
+	}
+}
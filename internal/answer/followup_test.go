@@ -0,0 +1,80 @@
+package answer
+
+import (
+	"compliance-form-filler/pkg/iohandler"
+	"testing"
+)
+
+func TestFollowUpCondition(t *testing.T) {
+	tests := []struct {
+		question      string
+		wantFollowUp  bool
+		wantCondition string
+	}{
+		{question: "If yes, please describe the procedure.", wantFollowUp: true, wantCondition: VerdictYes},
+		{question: "if so, how often?", wantFollowUp: true, wantCondition: VerdictYes},
+		{question: "If no, why not?", wantFollowUp: true, wantCondition: VerdictNo},
+		{question: "If not, explain the compensating controls.", wantFollowUp: true, wantCondition: VerdictNo},
+		{question: "(If yes) Who approves it?", wantFollowUp: true, wantCondition: VerdictYes},
+		{question: "Please describe it.", wantFollowUp: true},
+		{question: "Explain these controls.", wantFollowUp: true},
+		{question: "List them.", wantFollowUp: true},
+		{question: "Describe the procedure for revoking access.", wantFollowUp: false},
+		{question: "Provide the list of subprocessors.", wantFollowUp: false},
+		{question: "Is data encrypted at rest? If yes, with which algorithm?", wantFollowUp: false},
+		{question: "Ifyes the answer", wantFollowUp: false},
+		{question: "Si oui, veuillez décrire le processus.", wantFollowUp: true, wantCondition: VerdictYes},
+		{question: "Si ce n’est pas le cas, pourquoi ?", wantFollowUp: true, wantCondition: VerdictNo},
+		{question: "Dans l'affirmative, à quelle fréquence ?", wantFollowUp: true, wantCondition: VerdictYes},
+		{question: "Veuillez le décrire.", wantFollowUp: true},
+		{question: "Décrivez-les.", wantFollowUp: true},
+		{question: "Décrivez la procédure de sauvegarde.", wantFollowUp: false},
+		{question: "Wenn ja, beschreiben Sie bitte den Prozess.", wantFollowUp: true, wantCondition: VerdictYes},
+		{question: "Falls nicht, warum?", wantFollowUp: true, wantCondition: VerdictNo},
+		{question: "Bitte beschreiben Sie diese.", wantFollowUp: true},
+		{question: "Beschreiben Sie den Prozess.", wantFollowUp: false},
+		{question: "En caso afirmativo, describa el proceso.", wantFollowUp: true, wantCondition: VerdictYes},
+		{question: "Si no, ¿por qué?", wantFollowUp: true, wantCondition: VerdictNo},
+		{question: "Descríbalo.", wantFollowUp: true},
+		{question: "Sí, los datos están cifrados.", wantFollowUp: false},
+		{question: "Se sì, descrivere il processo.", wantFollowUp: true, wantCondition: VerdictYes},
+		{question: "In caso negativo, perché?", wantFollowUp: true, wantCondition: VerdictNo},
+		{question: "Si prega di descriverlo.", wantFollowUp: true},
+		{question: "Se si utilizza la cifratura, quale algoritmo?", wantFollowUp: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.question, func(t *testing.T) {
+			followUp, condition := followUpCondition(tt.question)
+			if followUp != tt.wantFollowUp || condition != tt.wantCondition {
+				t.Errorf("followUpCondition() = %t, %q, want %t, %q", followUp, condition, tt.wantFollowUp, tt.wantCondition)
+			}
+		})
+	}
+}
+
+func TestAnswerPolarity(t *testing.T) {
+	tests := []struct {
+		name   string
+		result iohandler.Result
+		want   string
+	}{
+		{name: "verdict", result: iohandler.Result{Answer: "Backups are encrypted.", Verdict: VerdictNo}, want: VerdictNo},
+		{name: "english yes", result: iohandler.Result{Answer: "Yes, backups are encrypted."}, want: VerdictYes},
+		{name: "english no", result: iohandler.Result{Answer: "No."}, want: VerdictNo},
+		{name: "french", result: iohandler.Result{Answer: "Non, aucun plan n'existe."}, want: VerdictNo},
+		{name: "german", result: iohandler.Result{Answer: "Ja, es gibt einen Notfallplan."}, want: VerdictYes},
+		{name: "spanish", result: iohandler.Result{Answer: "Sí, existe un plan."}, want: VerdictYes},
+		{name: "italian", result: iohandler.Result{Answer: "Sì, esiste un piano."}, want: VerdictYes},
+		{name: "single selected option", result: iohandler.Result{Answer: "The plan is tested yearly.", Selected: []string{"Yes"}}, want: VerdictYes},
+		{name: "no information", result: iohandler.Result{Answer: noInformationAnswer}},
+		{name: "not a verdict", result: iohandler.Result{Answer: "Nonetheless, backups are encrypted."}},
+		{name: "french condition", result: iohandler.Result{Answer: "Si le client le demande."}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := answerPolarity(&tt.result); got != tt.want {
+				t.Errorf("answerPolarity() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,130 @@
+package answer
+
+import (
+	"compliance-form-filler/pkg/iohandler"
+	"compliance-form-filler/pkg/llm"
+	"compliance-form-filler/pkg/logger"
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/qdrant/go-client/qdrant"
+)
+
+// noFollowUpQuery is the reply of the LLM when no other search could find the missing information
+const noFollowUpQuery = "NONE"
+
+// followUp runs up to maxHops follow-up searches while the LLM reports the snippets do not answer the question.
+// Each hop asks the LLM for a search query targeting the missing information, adds the new snippets to the
+// previous ones and answers again. It returns the last answer along with its prompt and snippets.
+func (p *pipeline) followUp(ctx context.Context, question string, result *iohandler.Result, questionPrompt string,
+	searchResult []*qdrant.ScoredPoint, originalScores map[string]float32) (*iohandler.Result, string, []*qdrant.ScoredPoint, error) {
+	var queries []string
+	for hop := 1; hop <= p.maxHops && !isApprovedAnswer(result.Answer); hop++ {
+		query, err := p.followUpQuery(ctx, question, searchResult, queries)
+		if err != nil {
+			return nil, "", nil, err
+		}
+		if query == "" {
+			logger.DefaultLogger.Info().Msgf("No follow-up search proposed by the LLM")
+			break
+		}
+		queries = append(queries, query)
+		logger.DefaultLogger.Info().Msgf("Follow-up search %d/%d: %s", hop, p.maxHops, query)
+
+		hopResult, hopScores, err := p.gatherSnippets(ctx, p.withSection(query), []string{p.withSection(query)})
+		if err != nil {
+			return nil, "", nil, err
+		}
+		merged := mergeSnippets(searchResult, hopResult)
+		if len(merged) == len(searchResult) {
+			logger.DefaultLogger.Info().Msgf("No new snippet found by the follow-up search")
+			continue
+		}
+		for key, score := range hopScores {
+			originalScores[key] = score
+		}
+		merged, err = p.selectSnippets(question, merged)
+		if err != nil {
+			return nil, "", nil, err
+		}
+		if len(merged) == 0 {
+			continue
+		}
+
+		hopPrompt, err := p.buildPrompt(question, merged)
+		if err != nil {
+			return nil, "", nil, err
+		}
+		logger.DefaultLogger.Info().Msgf("Sending prompt to LLM: %s", hopPrompt)
+		hopAnswer, err := p.generateAnswer(ctx, question, hopPrompt, merged)
+		if err != nil {
+			return nil, "", nil, err
+		}
+		result, questionPrompt, searchResult = hopAnswer, hopPrompt, merged
+	}
+	if len(queries) > 0 {
+		result.Notes = appendNote(result.Notes, fmt.Sprintf("follow-up searches: %s", strings.Join(queries, "; ")))
+	}
+	return result, questionPrompt, searchResult, nil
+}
+
+// followUpQuery asks the LLM, in a new conversation, for a search query finding the information missing to answer
+// the question. It returns an empty query when the LLM thinks no search could help.
+func (p *pipeline) followUpQuery(ctx context.Context, question string, searchResult []*qdrant.ScoredPoint, previousQueries []string) (string, error) {
+	var promptBuilder strings.Builder
+	if len(searchResult) == 0 {
+		promptBuilder.WriteString("Searching the company's policies and procedures with the following compliance questionnaire question found no snippet.\n")
+	} else {
+		promptBuilder.WriteString("The following compliance questionnaire question could not be answered from the snippets below.\n")
+	}
+	promptBuilder.WriteString("Propose one short search query to find the missing information in the company's policies and procedures.\n")
+	promptBuilder.WriteString(fmt.Sprintf("Reply only with the query, or with %s if no search could find it.\n\n", noFollowUpQuery))
+	promptBuilder.WriteString(fmt.Sprintf("Question: %s\n", question))
+	if len(searchResult) > 0 {
+		promptBuilder.WriteString("\nSnippets:\n")
+		for index, snippet := range snippetTexts(searchResult) {
+			promptBuilder.WriteString(fmt.Sprintf("Snippet %d: %s\n", index+1, snippet))
+		}
+	}
+	if len(previousQueries) > 0 {
+		promptBuilder.WriteString(fmt.Sprintf("\nQueries already searched: %s\n", strings.Join(previousQueries, "; ")))
+	}
+
+	response, err := p.llmClient.SendMessagesToLLM(ctx, []llm.Message{{Role: llm.RoleUser, Content: promptBuilder.String()}})
+	if err != nil {
+		return "", fmt.Errorf("failed to send follow-up search prompt to LLM: %w", err)
+	}
+	for _, line := range strings.Split(response, "\n") {
+		query := strings.Trim(strings.TrimSpace(listMarkerRegexp.ReplaceAllString(line, "")), `"'`)
+		if query == "" {
+			continue
+		}
+		if strings.EqualFold(strings.Trim(query, "."), noFollowUpQuery) || strings.EqualFold(query, question) {
+			return "", nil
+		}
+		for _, previous := range previousQueries {
+			if strings.EqualFold(query, previous) {
+				return "", nil
+			}
+		}
+		return query, nil
+	}
+	return "", nil
+}
+
+// mergeSnippets adds the new snippets after the previous ones, skipping those already present
+func mergeSnippets(previous, found []*qdrant.ScoredPoint) []*qdrant.ScoredPoint {
+	merged := append([]*qdrant.ScoredPoint(nil), previous...)
+	known := make(map[string]bool, len(previous))
+	for _, point := range previous {
+		known[point.GetId().String()] = true
+	}
+	for _, point := range found {
+		if !known[point.GetId().String()] {
+			known[point.GetId().String()] = true
+			merged = append(merged, point)
+		}
+	}
+	return merged
+}
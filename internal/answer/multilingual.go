@@ -0,0 +1,50 @@
+package answer
+
+import (
+	"compliance-form-filler/pkg/language"
+	"compliance-form-filler/pkg/llm"
+	"context"
+	"fmt"
+	"strings"
+)
+
+// answerLanguage returns the language the answer to the current question must be written in:
+// the forced one if any, the language of the question otherwise, empty when unknown.
+func (p *pipeline) answerLanguage() string {
+	if p.forcedLanguage != "" {
+		return p.forcedLanguage
+	}
+	return p.current.Language
+}
+
+// needsTranslation tells whether the current question must be translated to search the corpus
+func (p *pipeline) needsTranslation() bool {
+	return p.current.Language != "" && p.corpusLanguage != "" && p.current.Language != p.corpusLanguage
+}
+
+// crossLingualAnswer tells whether the answer to the current question is written in another language than the corpus,
+// the corpus being assumed in English when its language is not set
+func (p *pipeline) crossLingualAnswer() bool {
+	corpusLanguage := p.corpusLanguage
+	if corpusLanguage == "" {
+		corpusLanguage = language.English
+	}
+	lang := p.answerLanguage()
+	return lang != "" && lang != corpusLanguage
+}
+
+// translateQuery asks the LLM, in a new conversation, to translate the question into the language of the corpus
+func (p *pipeline) translateQuery(ctx context.Context, question string) (string, error) {
+	translatePrompt := fmt.Sprintf("Translate the following compliance questionnaire question from %s to %s, "+
+		"keeping acronyms and technical terms. Reply only with the translation.\n\nQuestion: %s",
+		language.Names[p.current.Language], language.Names[p.corpusLanguage], question)
+	response, err := p.llmClient.SendMessagesToLLM(ctx, []llm.Message{{Role: llm.RoleUser, Content: translatePrompt}})
+	if err != nil {
+		return "", fmt.Errorf("failed to send translation prompt to LLM: %w", err)
+	}
+	translation := strings.Trim(strings.TrimSpace(response), `"`)
+	if translation == "" {
+		return question, nil
+	}
+	return translation, nil
+}
@@ -0,0 +1,168 @@
+package answer
+
+import (
+	"compliance-form-filler/pkg/corpus"
+	"compliance-form-filler/pkg/logger"
+	"context"
+	"sort"
+	"strings"
+
+	"github.com/qdrant/go-client/qdrant"
+	"google.golang.org/protobuf/proto"
+)
+
+// maxSourceCopies is the number of copies of a source whose chunks may be returned when fetching the neighbors
+const maxSourceCopies = 4
+
+// expandNeighbors replaces the text of each snippet by the passage made of its chunk and the neighborChunks
+// chunks before and after it in the same source. Snippets whose chunk is already part of the passage of a
+// better snippet are dropped, so the same text is not sent twice.
+func (p *pipeline) expandNeighbors(ctx context.Context, points []*qdrant.ScoredPoint) ([]*qdrant.ScoredPoint, error) {
+	if p.neighborChunks <= 0 {
+		return points, nil
+	}
+
+	covered := make(map[string]map[int64]bool)
+	var expanded []*qdrant.ScoredPoint
+	for _, point := range points {
+		source, chunkIndex, ok := chunkPosition(point.Payload)
+		if !ok {
+			// Chunks ingested without their index cannot be expanded
+			expanded = append(expanded, point)
+			continue
+		}
+		if covered[source][chunkIndex] {
+			logger.DefaultLogger.Debug().Msgf("Snippet %d of %s already part of a passage, dropped", chunkIndex, source)
+			continue
+		}
+
+		neighbors, err := p.fetchChunks(ctx, point, source, chunkIndex-int64(p.neighborChunks), chunkIndex+int64(p.neighborChunks))
+		if err != nil {
+			return nil, err
+		}
+		if covered[source] == nil {
+			covered[source] = make(map[int64]bool)
+		}
+		texts := passageTexts(neighbors, chunkIndex, covered[source])
+		if len(texts) == 0 {
+			expanded = append(expanded, point)
+			continue
+		}
+
+		// The snippet keeps its score and identity, only its text becomes the whole passage
+		passage := proto.Clone(point).(*qdrant.ScoredPoint)
+		passage.Payload[qdrantTextFieldName] = qdrant.NewValueString(strings.Join(texts, "\n"))
+		expanded = append(expanded, passage)
+	}
+	return expanded, nil
+}
+
+// fetchChunks returns the chunks of the source of the point whose index is between first and last, in order.
+// Neighbors must match the search filter, and the metadata of the point, to stay in the same copy of the source
+// when several copies share its title. A single chunk is kept per index, the point itself for its own index.
+func (p *pipeline) fetchChunks(ctx context.Context, point *qdrant.ScoredPoint, source string, first, last int64) ([]*qdrant.RetrievedPoint, error) {
+	indexes := make([]int64, 0, last-first+1)
+	for index := max(first, 0); index <= last; index++ {
+		indexes = append(indexes, index)
+	}
+	// Copies of the source which could not be told apart also match, so they must not cut the neighbors off
+	limit := uint32(len(indexes) * maxSourceCopies)
+
+	filter := &qdrant.Filter{
+		Must: []*qdrant.Condition{
+			qdrant.NewMatch(qdrantSourceFieldName, source),
+			qdrant.NewMatchInts(qdrantChunkIndexFieldName, indexes...),
+		},
+	}
+	for _, field := range []string{corpus.FrameworkField, corpus.ProductField, corpus.DocTypeField} {
+		if value, ok := point.Payload[field]; ok && value.GetStringValue() != "" {
+			filter.Must = append(filter.Must, qdrant.NewMatch(field, value.GetStringValue()))
+		}
+	}
+	if p.filter != nil {
+		filter.Must = append(filter.Must, p.filter.Must...)
+		filter.MustNot = append(filter.MustNot, p.filter.MustNot...)
+	}
+
+	var chunks []*qdrant.RetrievedPoint
+	err := p.qdrantBreaker.Do(ctx, func(ctx context.Context) error {
+		var err error
+		chunks, err = p.qdrantClient.Scroll(ctx, &qdrant.ScrollPoints{
+			CollectionName: qdrantCollectionName,
+			Filter:         filter,
+			Limit:          &limit,
+			WithPayload:    qdrant.NewWithPayload(true),
+		})
+		return classifyQdrantError(err)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	_, pointIndex, _ := chunkPosition(point.Payload)
+	byIndex := make(map[int64]*qdrant.RetrievedPoint)
+	for _, chunk := range chunks {
+		_, chunkIndex, ok := chunkPosition(chunk.Payload)
+		if !ok {
+			continue
+		}
+		if chunkIndex == pointIndex {
+			if chunk.GetId().String() == point.GetId().String() {
+				byIndex[chunkIndex] = chunk
+			}
+			continue
+		}
+		if _, found := byIndex[chunkIndex]; !found {
+			byIndex[chunkIndex] = chunk
+		}
+	}
+	if _, found := byIndex[pointIndex]; !found {
+		byIndex[pointIndex] = &qdrant.RetrievedPoint{Id: point.GetId(), Payload: point.Payload}
+	}
+	unique := make([]*qdrant.RetrievedPoint, 0, len(byIndex))
+	for _, chunk := range byIndex {
+		unique = append(unique, chunk)
+	}
+	sort.Slice(unique, func(i, j int) bool {
+		_, first, _ := chunkPosition(unique[i].Payload)
+		_, second, _ := chunkPosition(unique[j].Payload)
+		return first < second
+	})
+	return unique, nil
+}
+
+// passageTexts returns the texts of the chunks of the passage around the snippet at chunkIndex, leaving out the chunks
+// already sent in the passage of a better snippet, and marks them as covered
+func passageTexts(neighbors []*qdrant.RetrievedPoint, chunkIndex int64, covered map[int64]bool) []string {
+	covered[chunkIndex] = true
+	texts := make([]string, 0, len(neighbors))
+	for _, neighbor := range neighbors {
+		_, neighborIndex, _ := chunkPosition(neighbor.Payload)
+		if covered[neighborIndex] && neighborIndex != chunkIndex {
+			continue
+		}
+		covered[neighborIndex] = true
+		texts = append(texts, neighbor.Payload[qdrantTextFieldName].GetStringValue())
+	}
+	return texts
+}
+
+// chunkPosition returns the source of a chunk and its index in the source, if both are in its payload
+func chunkPosition(payload map[string]*qdrant.Value) (string, int64, bool) {
+	source, ok := payload[qdrantSourceFieldName]
+	if !ok {
+		return "", 0, false
+	}
+	chunkIndex, ok := payload[qdrantChunkIndexFieldName]
+	if !ok {
+		return "", 0, false
+	}
+	switch kind := chunkIndex.GetKind().(type) {
+	case *qdrant.Value_IntegerValue:
+		return source.GetStringValue(), kind.IntegerValue, true
+	case *qdrant.Value_DoubleValue:
+		return source.GetStringValue(), int64(kind.DoubleValue), true
+	default:
+		return "", 0, false
+	}
+}
@@ -0,0 +1,43 @@
+package answer
+
+import (
+	"fmt"
+	"slices"
+	"testing"
+
+	"github.com/qdrant/go-client/qdrant"
+)
+
+func chunks(first, last int64) []*qdrant.RetrievedPoint {
+	var points []*qdrant.RetrievedPoint
+	for index := first; index <= last; index++ {
+		points = append(points, &qdrant.RetrievedPoint{
+			Id: qdrant.NewIDNum(uint64(index)),
+			Payload: map[string]*qdrant.Value{
+				qdrantSourceFieldName:     qdrant.NewValueString("policy.pdf"),
+				qdrantChunkIndexFieldName: qdrant.NewValueInt(index),
+				qdrantTextFieldName:       qdrant.NewValueString(fmt.Sprintf("chunk %d", index)),
+			},
+		})
+	}
+	return points
+}
+
+func TestPassageTexts(t *testing.T) {
+	// Snippets at indexes 5 then 7 with one neighbor chunk on each side: chunk 6 is only sent with 5
+	covered := make(map[int64]bool)
+	if got, want := passageTexts(chunks(4, 6), 5, covered), []string{"chunk 4", "chunk 5", "chunk 6"}; !slices.Equal(got, want) {
+		t.Errorf("first passage = %q, want %q", got, want)
+	}
+	if got, want := passageTexts(chunks(6, 8), 7, covered), []string{"chunk 7", "chunk 8"}; !slices.Equal(got, want) {
+		t.Errorf("second passage = %q, want %q", got, want)
+	}
+	for index := int64(4); index <= 8; index++ {
+		if !covered[index] {
+			t.Errorf("chunk %d not marked as covered", index)
+		}
+	}
+	if covered[9] {
+		t.Errorf("chunk 9 marked as covered")
+	}
+}
@@ -0,0 +1,398 @@
+package answer
+
+import (
+	"compliance-form-filler/pkg/embedding"
+	"compliance-form-filler/pkg/iohandler"
+	"compliance-form-filler/pkg/language"
+	"compliance-form-filler/pkg/llm"
+	"compliance-form-filler/pkg/logger"
+	"compliance-form-filler/pkg/prompt"
+	"compliance-form-filler/pkg/rerank"
+	"compliance-form-filler/pkg/retry"
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/qdrant/go-client/qdrant"
+)
+
+// pipeline holds the clients and settings used to answer each question
+type pipeline struct {
+	qdrantClient  *qdrant.Client
+	qdrantBreaker *retry.Breaker
+	llmClient     *llm.Client
+	// answerClient generates the answers, printing them while they are generated in live output mode
+	answerClient    *llm.Client
+	embeddingClient *embedding.Client
+	// retrievalMode is dense or hybrid, hybridWeight being the weight of the dense scores in hybrid mode
+	retrievalMode    string
+	hybridWeight     float64
+	sparseVectorName string
+	// filter restricts every search to the matching chunks, nil to search the whole corpus
+	filter *qdrant.Filter
+	// synonyms and queryRewrites expand the question into variants searched separately, nil and 0 to disable
+	synonyms      Synonyms
+	queryRewrites int
+	// reranker rescores the candidates before keeping the best rerankTopN of them, nil to disable
+	reranker   rerank.Reranker
+	rerankTopN int
+	// neighborChunks is the number of chunks added before and after each snippet, 0 to disable
+	neighborChunks int
+	// dedupThreshold is the word overlap above which a snippet is a near-duplicate of a better one, 0 to disable
+	dedupThreshold float64
+	// mmrTopK snippets are selected by maximal marginal relevance with mmrLambda, 0 to disable
+	mmrTopK   int
+	mmrLambda float64
+	// contextTokens is the context window of the model, answerTokens of them being reserved for the answer, 0 to disable
+	contextTokens int
+	answerTokens  int
+	// maxHops is the maximum number of follow-up searches while the snippets do not answer the question, 0 to disable
+	maxHops int
+	// current is the questionnaire item being answered: its section gives context to retrieval and prompts,
+	// and its type tells which kind of answer is expected
+	current iohandler.Question
+	// promptContext is given to the LLM after the current question, but not searched, e.g. the answer of its parent
+	promptContext string
+	// forcedLanguage is the language of every answer, empty to answer in the language of the question
+	forcedLanguage string
+	// corpusLanguage is the language of the corpus, questions in another language being translated to search it
+	corpusLanguage string
+	// decompose splits the compound questions into sub-questions answered separately
+	decompose bool
+	// baseMessages start every conversation: the task description followed by the few-shot examples
+	baseMessages []llm.Message
+	// carryHistory keeps the previous questions and answers in the conversation of the next questions
+	carryHistory bool
+	history      []llm.Message
+	// templates render the prompt of each question
+	templates       *prompt.Templates
+	promptVariables prompt.Variables
+
+	confidenceThreshold float64
+	verifyMode          string
+	verifyAction        string
+	structured          bool
+	structuredRetries   int
+	validator           FormatValidator
+	formatRetries       int
+}
+
+// answerQuestion answers the question of the questionnaire item, part by part when it is a compound free text one.
+// Any failure is returned, the error policy being applied by the caller.
+func (p *pipeline) answerQuestion(ctx context.Context, question string, item iohandler.Question, promptContext string) (*iohandler.Result, error) {
+	p.current, p.promptContext = item, promptContext
+	if p.decompose && item.Type == iohandler.QuestionTypeText {
+		subQuestions, err := p.decomposeQuestion(ctx, question)
+		if err != nil {
+			return nil, err
+		}
+		if len(subQuestions) > 1 {
+			logger.DefaultLogger.Info().Msgf("Question split into %d parts", len(subQuestions))
+			result, err := p.answerParts(ctx, question, subQuestions)
+			if err != nil {
+				return nil, err
+			}
+			p.remember(question, result.Answer)
+			return result, nil
+		}
+	}
+
+	result, questionPrompt, _, err := p.answerSingle(ctx, question)
+	if err != nil {
+		return nil, err
+	}
+	if questionPrompt != "" {
+		p.remember(questionPrompt, result.Answer)
+	}
+	return result, nil
+}
+
+// answerSingle retrieves the snippets related to the question and asks the LLM to answer it.
+// It returns the answer along with the prompt sent to the LLM, empty when no snippet was found, and the snippets given to it.
+func (p *pipeline) answerSingle(ctx context.Context, question string) (*iohandler.Result, string, []*qdrant.ScoredPoint, error) {
+	// Search the corpus in its own language, keeping the original question as a variant for multilingual embeddings
+	searchQuestion := question
+	if p.needsTranslation() {
+		translation, err := p.translateQuery(ctx, question)
+		if err != nil {
+			return nil, "", nil, err
+		}
+		logger.DefaultLogger.Info().Msgf("Question translated from %s for retrieval: %s", language.Names[p.current.Language], translation)
+		searchQuestion = translation
+	}
+
+	// Expand the question into alternative phrasings, if enabled
+	variants, err := p.queryVariants(ctx, searchQuestion)
+	if err != nil {
+		return nil, "", nil, err
+	}
+	if searchQuestion != question {
+		variants = uniqueStrings(append(variants, question))
+	}
+	if len(variants) > 1 {
+		logger.DefaultLogger.Info().Msgf("Question expanded into %d variants", len(variants))
+	}
+	// Terse questions are disambiguated by their section
+	for index, variant := range variants {
+		variants[index] = p.withSection(variant)
+	}
+
+	// Vectorize each variant using the embedding API and search in Qdrant
+	searchResult, originalScores, err := p.gatherSnippets(ctx, p.withSection(searchQuestion), variants)
+	if err != nil {
+		return nil, "", nil, err
+	}
+	searchResult, err = p.selectSnippets(question, searchResult)
+	if err != nil {
+		return nil, "", nil, err
+	}
+	var result *iohandler.Result
+	questionPrompt := ""
+	if len(searchResult) == 0 {
+		logger.DefaultLogger.Warn().Msgf("No results found for this question")
+		// Store a default answer if no results found
+		result = &iohandler.Result{Question: question, Answer: noInformationAnswer, Status: iohandler.StatusNoInformation, NeedsReview: true}
+	} else {
+		// Build the context string from search results and call the LLM
+		questionPrompt, err = p.buildPrompt(question, searchResult)
+		if err != nil {
+			return nil, "", nil, err
+		}
+		logger.DefaultLogger.Info().Msgf("Sending prompt to LLM: %s", questionPrompt)
+		result, err = p.generateAnswer(ctx, question, questionPrompt, searchResult)
+		if err != nil {
+			return nil, "", nil, err
+		}
+		logger.DefaultLogger.Info().Msgf("LLM response received for question: %s", question)
+	}
+
+	// Search for the missing evidence while the LLM cannot answer, or nothing was found
+	if originalScores == nil && p.reranker != nil {
+		originalScores = make(map[string]float32)
+	}
+	result, questionPrompt, searchResult, err = p.followUp(ctx, question, result, questionPrompt, searchResult, originalScores)
+	if err != nil {
+		return nil, "", nil, err
+	}
+	if len(searchResult) == 0 {
+		return result, "", nil, nil
+	}
+	result.Evidence = buildEvidence(searchResult, originalScores)
+	// Flag the answer according to its confidence
+	logger.DefaultLogger.Info().Msgf("Answer confidence: %.2f", result.Confidence)
+	result.NeedsReview = result.NeedsReview || result.Confidence < p.confidenceThreshold
+
+	// Check the answer is grounded in the snippets
+	if err = p.verifyResult(ctx, result, searchResult); err != nil {
+		return nil, "", nil, err
+	}
+	return result, questionPrompt, searchResult, nil
+}
+
+// verifyResult checks the answer is grounded in the snippets when verification is enabled,
+// flagging or replacing it according to the verify action
+func (p *pipeline) verifyResult(ctx context.Context, result *iohandler.Result, searchResult []*qdrant.ScoredPoint) error {
+	if p.verifyMode == VerifyNone {
+		return nil
+	}
+	// Words cannot overlap across languages, only the LLM can compare an answer to snippets in another language
+	mode := p.verifyMode
+	if mode == VerifyOverlap && p.crossLingualAnswer() {
+		mode = VerifyLLM
+		result.Notes = appendNote(result.Notes, fmt.Sprintf("verified by the LLM instead of word overlap, the answer being in %s", language.Names[p.answerLanguage()]))
+	}
+	logger.DefaultLogger.Info().Msgf("Verifying answer groundedness (%s)...", mode)
+	verification, err := VerifyAnswer(ctx, mode, p.llmClient, result.Answer, searchResult)
+	if err != nil {
+		return fmt.Errorf("failed to verify answer: %w", err)
+	}
+	if !verification.Supported {
+		logger.DefaultLogger.Warn().Msgf("Answer not grounded in the snippets (%.0f%% supported), applying action: %s", verification.Ratio*100, p.verifyAction)
+		result.Notes = appendNote(result.Notes, verification.Reason())
+		result.NeedsReview = true
+		if p.verifyAction == VerifyActionReplace {
+			result.Answer = noInformationAnswer
+			result.Confidence = 0
+			result.CitedSources = nil
+			result.Selected = nil
+			if result.Verdict != "" {
+				result.Verdict = VerdictNA
+			}
+		} else {
+			result.Confidence *= verification.Ratio
+		}
+	}
+	return nil
+}
+
+// generateAnswer calls the LLM, in free text or structured mode, and re-prompts it
+// as long as the answer violates the format rules and retries are left.
+func (p *pipeline) generateAnswer(ctx context.Context, question, questionPrompt string, searchResult []*qdrant.ScoredPoint) (*iohandler.Result, error) {
+	messages := slices.Concat(p.baseMessages, p.history, []llm.Message{{Role: llm.RoleUser, Content: questionPrompt}})
+	for attempt := 0; ; attempt++ {
+		if attempt > 0 {
+			p.printAnswer("\n")
+		}
+		result := &iohandler.Result{Question: question}
+		if p.current.Type != iohandler.QuestionTypeText {
+			choiceAnswer, err := AskChoiceAnswer(ctx, p.llmClient, messages, p.current, len(searchResult), p.structuredRetries)
+			if err != nil {
+				return nil, err
+			}
+			result.Answer = choiceAnswer.Justification
+			result.Selected = choiceAnswer.Selected
+			result.CitedSources = citedSources(searchResult, choiceAnswer.CitedSnippets)
+			result.Confidence = ComputeConfidence(searchResult, choiceAnswer.Justification)
+			p.printAnswer(fmt.Sprintf("[%s] %s", strings.Join(choiceAnswer.Selected, iohandler.SelectedSeparator), result.Answer))
+		} else if p.structured {
+			structuredAnswer, err := AskStructuredAnswer(ctx, p.llmClient, messages, len(searchResult), p.structuredRetries)
+			if err != nil {
+				return nil, err
+			}
+			result.Answer = structuredAnswer.Answer
+			result.Verdict = structuredAnswer.Verdict
+			result.CitedSources = citedSources(searchResult, structuredAnswer.CitedSnippets)
+			result.Confidence = ComputeStructuredConfidence(searchResult, structuredAnswer)
+			p.printAnswer(result.Answer)
+		} else {
+			answer, err := p.answerClient.SendMessagesToLLM(ctx, messages)
+			if err != nil {
+				return nil, fmt.Errorf("failed to send prompt to LLM: %w", err)
+			}
+			result.Answer = answer
+			result.Confidence = ComputeConfidence(searchResult, answer)
+		}
+
+		violations := p.answerValidator().Validate(result.Answer)
+		if len(violations) == 0 {
+			return result, nil
+		}
+		if attempt >= p.formatRetries {
+			logger.DefaultLogger.Warn().Msgf("Answer still violates the format rules after %d retries: %s", p.formatRetries, strings.Join(violations, "; "))
+			result.NeedsReview = true
+			result.Notes = fmt.Sprintf("invalid format after %d retries: %s", p.formatRetries, strings.Join(violations, "; "))
+			return result, nil
+		}
+		logger.DefaultLogger.Warn().Msgf("Answer violates the format rules (%s), retrying (%d/%d)...", strings.Join(violations, "; "), attempt+1, p.formatRetries)
+		messages = append(messages,
+			llm.Message{Role: llm.RoleAssistant, Content: result.Answer},
+			llm.Message{Role: llm.RoleUser, Content: formatFeedback(violations)},
+		)
+	}
+}
+
+// gatherSnippets searches the variants of the query, reranks the candidates and merges them with their neighbor chunks.
+// It returns the snippets along with their scores before reranking, nil when there is no reranker.
+func (p *pipeline) gatherSnippets(ctx context.Context, query string, variants []string) ([]*qdrant.ScoredPoint, map[string]float32, error) {
+	searchResult, err := p.retrieveVariants(ctx, variants)
+	if err != nil {
+		return nil, nil, err
+	}
+	logger.DefaultLogger.Info().Msgf("Qdrant search completed")
+
+	// Rescore the candidates with the reranker
+	searchResult, originalScores, err := p.rerank(ctx, query, searchResult)
+	if err != nil {
+		return nil, nil, err
+	}
+	if originalScores != nil {
+		logger.DefaultLogger.Info().Msgf("Snippets reranked, %d kept", len(searchResult))
+	}
+
+	// Merge each snippet with its neighbor chunks into a contiguous passage
+	searchResult, err = p.expandNeighbors(ctx, searchResult)
+	if err != nil {
+		return nil, nil, err
+	}
+	return searchResult, originalScores, nil
+}
+
+// selectSnippets drops the near-duplicate snippets, favors distinct evidence and keeps the snippets fitting in the prompt
+func (p *pipeline) selectSnippets(question string, searchResult []*qdrant.ScoredPoint) ([]*qdrant.ScoredPoint, error) {
+	candidates := len(searchResult)
+	searchResult = deduplicateSnippets(searchResult, p.dedupThreshold)
+	searchResult = selectDiverseSnippets(searchResult, p.mmrTopK, p.mmrLambda)
+	if len(searchResult) < candidates {
+		logger.DefaultLogger.Info().Msgf("%d snippets kept out of %d after deduplication and diversity selection", len(searchResult), candidates)
+	}
+	return p.fitTokenBudget(question, searchResult)
+}
+
+// remember adds the question and its final answer to the history, when it is carried between questions
+func (p *pipeline) remember(questionPrompt, answer string) {
+	if !p.carryHistory {
+		return
+	}
+	p.history = append(p.history,
+		llm.Message{Role: llm.RoleUser, Content: questionPrompt},
+		llm.Message{Role: llm.RoleAssistant, Content: answer},
+	)
+}
+
+// printAnswer prints the answer in live output mode, for the replies not streamed as is, like the structured ones
+func (p *pipeline) printAnswer(answer string) {
+	if p.answerClient.OnToken != nil {
+		p.answerClient.OnToken(answer)
+	}
+}
+
+// questionData returns the data of the question template for the current question, without snippets
+func (p *pipeline) questionData(question string) prompt.QuestionData {
+	data := prompt.QuestionData{Variables: p.promptVariables, Question: question, Section: p.current.Section}
+	if p.promptContext != "" {
+		data.Question = question + "\n" + p.promptContext
+	}
+	// English being the language of the instructions, only other languages are requested explicitly
+	if lang := p.answerLanguage(); lang != "" && lang != language.English {
+		data.AnswerLanguage = language.Names[lang]
+	}
+	return data
+}
+
+// buildPrompt renders the question template, mentioning for each point its index, its value, its score and its source
+func (p *pipeline) buildPrompt(question string, searchResult []*qdrant.ScoredPoint) (string, error) {
+	data := p.questionData(question)
+	for index, point := range searchResult {
+		if text, ok := point.Payload[qdrantTextFieldName]; ok {
+			if source, ok := point.Payload[qdrantSourceFieldName]; ok {
+				data.Snippets = append(data.Snippets, prompt.Snippet{
+					Index:  index + 1,
+					Text:   text.GetStringValue(),
+					Score:  point.Score,
+					Source: source.GetStringValue(),
+				})
+			}
+		}
+	}
+	return p.templates.Question(data)
+}
+
+// answerValidator returns the format validator of the current question, requiring its answer language
+// unless a language is required for every answer. The language of the question is only enforced when
+// it is not English, detection falling back to English when unsure.
+func (p *pipeline) answerValidator() FormatValidator {
+	validator := p.validator
+	if validator.Language == "" {
+		if lang := p.answerLanguage(); p.forcedLanguage != "" || lang != language.English {
+			validator.Language = lang
+		}
+	}
+	return validator
+}
+
+// withSection prefixes the search query with the section of the question, if any
+func (p *pipeline) withSection(query string) string {
+	if p.current.Section == "" {
+		return query
+	}
+	return p.current.Section + ": " + query
+}
+
+// appendNote adds a note to the existing ones
+func appendNote(notes, note string) string {
+	if notes == "" {
+		return note
+	}
+	return notes + " | " + note
+}
@@ -0,0 +1,64 @@
+package answer
+
+import (
+	"compliance-form-filler/pkg/iohandler"
+	"context"
+	"fmt"
+	"sort"
+
+	"github.com/qdrant/go-client/qdrant"
+)
+
+// Reranking modes
+const (
+	RerankerNone         = "none"
+	RerankerCrossEncoder = "cross-encoder"
+	RerankerLLM          = "llm"
+)
+
+// rerank rescores the candidates with the reranker and keeps the best rerankTopN of them.
+// The scores of the returned points are the reranked ones, the original scores being returned by point ID.
+func (p *pipeline) rerank(ctx context.Context, question string, points []*qdrant.ScoredPoint) ([]*qdrant.ScoredPoint, map[string]float32, error) {
+	if p.reranker == nil || len(points) == 0 {
+		return points, nil, nil
+	}
+
+	scores, err := p.reranker.Rerank(ctx, question, snippetTexts(points))
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to rerank snippets: %w", err)
+	}
+	if len(scores) != len(points) {
+		return nil, nil, fmt.Errorf("reranker returned %d scores for %d snippets", len(scores), len(points))
+	}
+
+	originalScores := make(map[string]float32, len(points))
+	reranked := make([]*qdrant.ScoredPoint, len(points))
+	for index, point := range points {
+		originalScores[point.GetId().String()] = point.Score
+		point.Score = float32(scores[index])
+		reranked[index] = point
+	}
+	sort.SliceStable(reranked, func(i, j int) bool { return reranked[i].Score > reranked[j].Score })
+	if p.rerankTopN > 0 && len(reranked) > p.rerankTopN {
+		reranked = reranked[:p.rerankTopN]
+	}
+	return reranked, originalScores, nil
+}
+
+// buildEvidence lists the snippets an answer is based on, with their retrieval score and their reranked score if any
+func buildEvidence(points []*qdrant.ScoredPoint, originalScores map[string]float32) []iohandler.Evidence {
+	evidence := make([]iohandler.Evidence, 0, len(points))
+	for _, point := range points {
+		item := iohandler.Evidence{Score: float64(point.Score)}
+		if source, ok := point.Payload[qdrantSourceFieldName]; ok {
+			item.Source = source.GetStringValue()
+		}
+		if originalScore, ok := originalScores[point.GetId().String()]; ok {
+			rerankScore := float64(point.Score)
+			item.Score = float64(originalScore)
+			item.RerankScore = &rerankScore
+		}
+		evidence = append(evidence, item)
+	}
+	return evidence
+}
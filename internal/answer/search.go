@@ -0,0 +1,173 @@
+package answer
+
+import (
+	"compliance-form-filler/pkg/retry"
+	"compliance-form-filler/pkg/sparse"
+	"context"
+	"fmt"
+	"sort"
+
+	"github.com/qdrant/go-client/qdrant"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Retrieval modes
+const (
+	// RetrievalDense only searches the dense vectors of the chunks
+	RetrievalDense = "dense"
+	// RetrievalHybrid combines the dense search with a keyword search on the sparse vectors of the chunks
+	RetrievalHybrid = "hybrid"
+)
+
+const (
+	// scoreThreshold is the minimum dense similarity of a snippet, in dense and hybrid mode
+	scoreThreshold float32 = 0.4
+	// keywordScoreThreshold is the minimum keyword score of a snippet in hybrid mode, about the weight of
+	// a single term found in a few percent of the chunks, so that a chunk sharing only common words is left out
+	keywordScoreThreshold float32 = 1
+	// searchLimit is the number of snippets kept, which is the Qdrant default limit
+	searchLimit = 10
+	// hybridCandidates is the number of candidates fetched by each search before the fusion
+	hybridCandidates = 2 * searchLimit
+)
+
+// retrieve searches the chunks related to the question, according to the retrieval mode
+func (p *pipeline) retrieve(ctx context.Context, question string, vector []float32) ([]*qdrant.ScoredPoint, error) {
+	if p.retrievalMode != RetrievalHybrid {
+		threshold := scoreThreshold
+		return p.search(ctx, &qdrant.QueryPoints{
+			CollectionName: qdrantCollectionName,
+			Query:          qdrant.NewQuery(vector...),
+			Filter:         p.filter,
+			WithPayload:    qdrant.NewWithPayload(true),
+			ScoreThreshold: &threshold,
+		})
+	}
+
+	// Each search has its own threshold, the fused scores of the chunks found by a single search
+	// being too low to be compared with them
+	limit := uint64(hybridCandidates)
+	threshold := scoreThreshold
+	keywordThreshold := keywordScoreThreshold
+	queries := []*qdrant.QueryPoints{
+		{
+			CollectionName: qdrantCollectionName,
+			Query:          qdrant.NewQuery(vector...),
+			Filter:         p.filter,
+			WithPayload:    qdrant.NewWithPayload(true),
+			ScoreThreshold: &threshold,
+			Limit:          &limit,
+		},
+	}
+	// A query made only of stop words has no keyword to search
+	if indices, values := sparse.EncodeQuery(question); len(indices) > 0 {
+		queries = append(queries, &qdrant.QueryPoints{
+			CollectionName: qdrantCollectionName,
+			Query:          qdrant.NewQuerySparse(indices, values),
+			Using:          &p.sparseVectorName,
+			Filter:         p.filter,
+			WithPayload:    qdrant.NewWithPayload(true),
+			ScoreThreshold: &keywordThreshold,
+			Limit:          &limit,
+		})
+	}
+	batch, err := p.searchBatch(ctx, &qdrant.QueryBatchPoints{
+		CollectionName: qdrantCollectionName,
+		QueryPoints:    queries,
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(batch) != len(queries) {
+		return nil, fmt.Errorf("unexpected number of hybrid search results: %d", len(batch))
+	}
+	var keyword []*qdrant.ScoredPoint
+	if len(batch) > 1 {
+		keyword = batch[1].GetResult()
+	}
+	return fuseResults(batch[0].GetResult(), keyword, p.hybridWeight), nil
+}
+
+// fuseResults combines the dense and keyword results with a weighted sum of their scores.
+// Keyword scores are unbounded, so they are normalized by the best one to be comparable with the dense similarities.
+// Each result is thresholded with the threshold of its search, before the fusion, so that a chunk found by a single
+// search is kept when it ranks among the best fused ones, and a weak keyword match cannot be normalized to full weight.
+func fuseResults(dense, keyword []*qdrant.ScoredPoint, denseWeight float64) []*qdrant.ScoredPoint {
+	fused := make(map[string]*qdrant.ScoredPoint)
+	scores := make(map[string]float64)
+	for _, point := range dense {
+		if point.Score < scoreThreshold {
+			continue
+		}
+		key := point.GetId().String()
+		fused[key] = point
+		scores[key] += denseWeight * float64(point.Score)
+	}
+	bestKeywordScore := float32(0)
+	for _, point := range keyword {
+		bestKeywordScore = max(bestKeywordScore, point.Score)
+	}
+	if bestKeywordScore >= keywordScoreThreshold {
+		for _, point := range keyword {
+			if point.Score < keywordScoreThreshold {
+				continue
+			}
+			key := point.GetId().String()
+			if _, ok := fused[key]; !ok {
+				fused[key] = point
+			}
+			scores[key] += (1 - denseWeight) * float64(point.Score/bestKeywordScore)
+		}
+	}
+
+	var points []*qdrant.ScoredPoint
+	for key, point := range fused {
+		point.Score = float32(scores[key])
+		points = append(points, point)
+	}
+	sort.SliceStable(points, func(i, j int) bool { return points[i].Score > points[j].Score })
+	if len(points) > searchLimit {
+		points = points[:searchLimit]
+	}
+	return points
+}
+
+// search queries Qdrant through the breaker, retrying the transient failures
+func (p *pipeline) search(ctx context.Context, query *qdrant.QueryPoints) ([]*qdrant.ScoredPoint, error) {
+	var points []*qdrant.ScoredPoint
+	err := p.qdrantBreaker.Do(ctx, func(ctx context.Context) error {
+		var err error
+		points, err = p.qdrantClient.Query(ctx, query)
+		return classifyQdrantError(err)
+	})
+	return points, err
+}
+
+// searchBatch sends several queries to Qdrant at once through the breaker, retrying the transient failures
+func (p *pipeline) searchBatch(ctx context.Context, query *qdrant.QueryBatchPoints) ([]*qdrant.BatchResult, error) {
+	var results []*qdrant.BatchResult
+	err := p.qdrantBreaker.Do(ctx, func(ctx context.Context) error {
+		var err error
+		results, err = p.qdrantClient.QueryBatch(ctx, query)
+		return classifyQdrantError(err)
+	})
+	return results, err
+}
+
+// classifyQdrantError marks the gRPC errors which are not transient as permanent
+func classifyQdrantError(err error) error {
+	if err == nil {
+		return nil
+	}
+	grpcStatus, ok := status.FromError(err)
+	if !ok {
+		return err
+	}
+	switch grpcStatus.Code() {
+	case codes.Unavailable, codes.DeadlineExceeded, codes.ResourceExhausted, codes.Aborted, codes.Internal, codes.Unknown:
+		return err
+	default:
+		return retry.Permanent(err)
+	}
+}
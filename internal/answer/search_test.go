@@ -0,0 +1,115 @@
+package answer
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/qdrant/go-client/qdrant"
+)
+
+func scoredPoint(id uint64, score float32) *qdrant.ScoredPoint {
+	return &qdrant.ScoredPoint{Id: qdrant.NewIDNum(id), Score: score}
+}
+
+func TestFuseResults(t *testing.T) {
+	tests := []struct {
+		name        string
+		dense       []*qdrant.ScoredPoint
+		keyword     []*qdrant.ScoredPoint
+		denseWeight float64
+		wantIDs     []uint64
+		wantScores  []float32
+	}{
+		{
+			name:        "dense only",
+			dense:       []*qdrant.ScoredPoint{scoredPoint(1, 0.8), scoredPoint(2, 0.6)},
+			denseWeight: 0.7,
+			wantIDs:     []uint64{1, 2},
+			wantScores:  []float32{0.56, 0.42},
+		},
+		{
+			name:        "dense below threshold dropped",
+			dense:       []*qdrant.ScoredPoint{scoredPoint(1, 0.8), scoredPoint(2, 0.3)},
+			denseWeight: 0.7,
+			wantIDs:     []uint64{1},
+			wantScores:  []float32{0.56},
+		},
+		{
+			name:        "keyword-only hit kept",
+			dense:       []*qdrant.ScoredPoint{scoredPoint(1, 0.5)},
+			keyword:     []*qdrant.ScoredPoint{scoredPoint(2, 12), scoredPoint(3, 6)},
+			denseWeight: 0.7,
+			wantIDs:     []uint64{1, 2, 3},
+			wantScores:  []float32{0.35, 0.3, 0.15},
+		},
+		{
+			name:        "hit found by both searches",
+			dense:       []*qdrant.ScoredPoint{scoredPoint(1, 0.5), scoredPoint(2, 0.9)},
+			keyword:     []*qdrant.ScoredPoint{scoredPoint(1, 4), scoredPoint(2, 2)},
+			denseWeight: 0.5,
+			wantIDs:     []uint64{1, 2},
+			wantScores:  []float32{0.75, 0.7},
+		},
+		{
+			name:        "weak keyword hits dropped",
+			dense:       []*qdrant.ScoredPoint{scoredPoint(1, 0.6)},
+			keyword:     []*qdrant.ScoredPoint{scoredPoint(2, 0.9), scoredPoint(3, 0.2)},
+			denseWeight: 0.5,
+			wantIDs:     []uint64{1},
+			wantScores:  []float32{0.3},
+		},
+		{
+			name:        "keyword hits normalized by the best one above the threshold",
+			keyword:     []*qdrant.ScoredPoint{scoredPoint(1, 4), scoredPoint(2, 2), scoredPoint(3, 0.5)},
+			denseWeight: 0.5,
+			wantIDs:     []uint64{1, 2},
+			wantScores:  []float32{0.5, 0.25},
+		},
+		{
+			name:        "keyword scores all zero ignored",
+			dense:       []*qdrant.ScoredPoint{scoredPoint(1, 0.6)},
+			keyword:     []*qdrant.ScoredPoint{scoredPoint(2, 0)},
+			denseWeight: 0.5,
+			wantIDs:     []uint64{1},
+			wantScores:  []float32{0.3},
+		},
+		{
+			name:        "nothing found",
+			denseWeight: 0.7,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			points := fuseResults(tt.dense, tt.keyword, tt.denseWeight)
+			var ids []uint64
+			for index, point := range points {
+				ids = append(ids, point.GetId().GetNum())
+				if index < len(tt.wantScores) && !closeTo(point.Score, tt.wantScores[index]) {
+					t.Errorf("score of point %d = %f, want %f", point.GetId().GetNum(), point.Score, tt.wantScores[index])
+				}
+			}
+			if !slices.Equal(ids, tt.wantIDs) {
+				t.Errorf("fuseResults() ids = %v, want %v", ids, tt.wantIDs)
+			}
+		})
+	}
+}
+
+func TestFuseResultsLimit(t *testing.T) {
+	var dense []*qdrant.ScoredPoint
+	for id := uint64(1); id <= searchLimit+5; id++ {
+		dense = append(dense, scoredPoint(id, 0.5+float32(id)/100))
+	}
+	points := fuseResults(dense, nil, 1)
+	if len(points) != searchLimit {
+		t.Fatalf("fuseResults() returned %d points, want %d", len(points), searchLimit)
+	}
+	if got := points[0].GetId().GetNum(); got != searchLimit+5 {
+		t.Errorf("best point = %d, want %d", got, searchLimit+5)
+	}
+}
+
+func closeTo(a, b float32) bool {
+	diff := a - b
+	return diff < 1e-5 && diff > -1e-5
+}
@@ -0,0 +1,133 @@
+package answer
+
+import (
+	"compliance-form-filler/pkg/llm"
+	"compliance-form-filler/pkg/logger"
+	"context"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/qdrant/go-client/qdrant"
+)
+
+// Verdicts of a structured answer
+const (
+	VerdictYes     = "Yes"
+	VerdictNo      = "No"
+	VerdictPartial = "Partial"
+	VerdictNA      = "N/A"
+)
+
+// structuredAnswerSchema is the JSON schema the LLM must follow in structured mode
+var structuredAnswerSchema = json.RawMessage(`{
+  "type": "object",
+  "properties": {
+    "verdict": {"type": "string", "enum": ["Yes", "No", "Partial", "N/A"]},
+    "answer": {"type": "string"},
+    "cited_snippets": {"type": "array", "items": {"type": "integer"}},
+    "confidence": {"type": "number", "minimum": 0, "maximum": 1}
+  },
+  "required": ["verdict", "answer", "cited_snippets", "confidence"]
+}`)
+
+// structuredAnswerInstructions is appended to the prompt in structured mode
+const structuredAnswerInstructions = `Reply only with a JSON object with the following fields:
+- "verdict": "Yes", "No" or "Partial" when the question implies a yes/no answer, "N/A" otherwise or when no information is available,
+- "answer": the answer following the rules above,
+- "cited_snippets": the numbers of the responses the answer is based on (e.g. [1, 3]), empty when no information is available,
+- "confidence": your confidence in the answer, between 0 and 1.`
+
+// StructuredAnswer is the answer returned by the LLM in structured mode
+type StructuredAnswer struct {
+	Verdict       string  `json:"verdict"`
+	Answer        string  `json:"answer"`
+	CitedSnippets []int   `json:"cited_snippets"`
+	Confidence    float64 `json:"confidence"`
+}
+
+// Validate checks the structured answer is consistent, snippetCount being the number of snippets in the prompt
+func (a StructuredAnswer) Validate(snippetCount int) error {
+	switch a.Verdict {
+	case VerdictYes, VerdictNo, VerdictPartial, VerdictNA:
+	default:
+		return fmt.Errorf("invalid verdict: %q", a.Verdict)
+	}
+	if strings.TrimSpace(a.Answer) == "" {
+		return fmt.Errorf("empty answer")
+	}
+	for _, snippet := range a.CitedSnippets {
+		if snippet < 1 || snippet > snippetCount {
+			return fmt.Errorf("cited snippet %d out of range [1, %d]", snippet, snippetCount)
+		}
+	}
+	if a.Confidence < 0 || a.Confidence > 1 {
+		return fmt.Errorf("confidence %f out of range [0, 1]", a.Confidence)
+	}
+	return nil
+}
+
+// AskStructuredAnswer sends the conversation in structured mode, and retries up to maxRetries times when the response is malformed.
+// The structured answer instructions are appended to the last message of the conversation.
+func AskStructuredAnswer(ctx context.Context, llmClient *llm.Client, messages []llm.Message, snippetCount, maxRetries int) (StructuredAnswer, error) {
+	return askJSONAnswer(ctx, llmClient, messages, "structured", structuredAnswerSchema, structuredAnswerInstructions,
+		func(answer *StructuredAnswer) error { return answer.Validate(snippetCount) }, maxRetries)
+}
+
+// askJSONAnswer sends the conversation with the instructions appended to its last message, the reply following the schema.
+// It retries up to maxRetries times when the reply is malformed or rejected by validate, telling the LLM what was wrong.
+// kind names the answer in logs and errors.
+func askJSONAnswer[T any](ctx context.Context, llmClient *llm.Client, messages []llm.Message, kind string, schema json.RawMessage,
+	instructions string, validate func(answer *T) error, maxRetries int) (T, error) {
+	messages = slices.Clone(messages)
+	last := &messages[len(messages)-1]
+	last.Content = fmt.Sprintf("%s\n\n%s", last.Content, instructions)
+	var lastErr error
+	for attempt := 0; attempt <= maxRetries; attempt++ {
+		if attempt > 0 {
+			logger.DefaultLogger.Warn().Msgf("Invalid %s answer (%s), retrying (%d/%d)...", kind, lastErr, attempt, maxRetries)
+		}
+		response, err := llmClient.SendStructuredMessagesToLLM(ctx, messages, schema)
+		if err != nil {
+			var zero T
+			return zero, fmt.Errorf("failed to send prompt to LLM: %w", err)
+		}
+
+		var answer T
+		if err := json.Unmarshal([]byte(response), &answer); err != nil {
+			lastErr = fmt.Errorf("invalid JSON: %w", err)
+		} else if err := validate(&answer); err != nil {
+			lastErr = err
+		} else {
+			return answer, nil
+		}
+		// Tell the LLM what was wrong, resending the same conversation would give the same reply with a fixed seed
+		messages = append(messages,
+			llm.Message{Role: llm.RoleAssistant, Content: response},
+			llm.Message{Role: llm.RoleUser, Content: structuredFeedback(lastErr)},
+		)
+	}
+	var zero T
+	return zero, fmt.Errorf("no valid %s answer after %d attempts: %w", kind, maxRetries+1, lastErr)
+}
+
+// structuredFeedback asks the LLM to fix its malformed structured reply
+func structuredFeedback(err error) string {
+	return fmt.Sprintf("Your previous reply is not valid: %s.\nReply again with a valid JSON object, following all the instructions.", err)
+}
+
+// citedSources returns the distinct sources of the snippets cited by a structured answer
+func citedSources(points []*qdrant.ScoredPoint, citedSnippets []int) []string {
+	var sources []string
+	seen := make(map[string]bool)
+	for _, snippet := range citedSnippets {
+		source, ok := points[snippet-1].Payload[qdrantSourceFieldName]
+		if !ok || seen[source.GetStringValue()] {
+			continue
+		}
+		seen[source.GetStringValue()] = true
+		sources = append(sources, source.GetStringValue())
+	}
+	return sources
+}
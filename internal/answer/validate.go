@@ -0,0 +1,76 @@
+package answer
+
+import (
+	"compliance-form-filler/pkg/language"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// bareVerdictRegexp matches answers made only of a verdict, like "Yes." or "no"
+var bareVerdictRegexp = regexp.MustCompile(`(?i)^\W*(yes|no|partial|n/a)\W*$`)
+
+// FormatValidator checks the answers returned by the LLM follow the expected format
+type FormatValidator struct {
+	// MaxLines is the maximum number of non empty lines, 0 to disable
+	MaxLines int
+	// MaxCharacters is the maximum number of characters, 0 to disable
+	MaxCharacters int
+	// ForbidBareVerdict rejects answers made only of "Yes" or "No"
+	ForbidBareVerdict bool
+	// ForbiddenPhrases are rejected wherever they appear, case insensitively
+	ForbiddenPhrases []string
+	// Language is the ISO 639-1 code of the language the answer must be written in, empty to disable
+	Language string
+}
+
+// Validate returns the list of rules violated by the answer.
+// "No information available" is always a valid answer.
+func (v FormatValidator) Validate(answer string) []string {
+	answer = strings.TrimSpace(answer)
+	if answer == noInformationAnswer {
+		return nil
+	}
+
+	var violations []string
+	if answer == "" {
+		violations = append(violations, "the answer is empty")
+		return violations
+	}
+	if v.MaxLines > 0 {
+		lines := 0
+		for _, line := range strings.Split(answer, "\n") {
+			if strings.TrimSpace(line) != "" {
+				lines++
+			}
+		}
+		if lines > v.MaxLines {
+			violations = append(violations, fmt.Sprintf("the answer has %d lines, the maximum is %d", lines, v.MaxLines))
+		}
+	}
+	if v.MaxCharacters > 0 {
+		if characters := len([]rune(answer)); characters > v.MaxCharacters {
+			violations = append(violations, fmt.Sprintf("the answer has %d characters, the maximum is %d", characters, v.MaxCharacters))
+		}
+	}
+	if v.ForbidBareVerdict && bareVerdictRegexp.MatchString(answer) {
+		violations = append(violations, "the answer is only a verdict without justification")
+	}
+	lowerAnswer := strings.ToLower(answer)
+	for _, phrase := range v.ForbiddenPhrases {
+		if phrase != "" && strings.Contains(lowerAnswer, strings.ToLower(phrase)) {
+			violations = append(violations, fmt.Sprintf("the answer contains the forbidden phrase %q", phrase))
+		}
+	}
+	if v.Language != "" {
+		if detected := language.Detect(answer); detected != "" && detected != v.Language {
+			violations = append(violations, fmt.Sprintf("the answer must be written in %s", language.Names[v.Language]))
+		}
+	}
+	return violations
+}
+
+// formatFeedback builds the message asking the LLM to fix the violations of its previous answer
+func formatFeedback(violations []string) string {
+	return fmt.Sprintf("Your previous answer does not follow the rules: %s.\nAnswer again, following all the rules.", strings.Join(violations, "; "))
+}
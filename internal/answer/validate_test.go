@@ -0,0 +1,42 @@
+package answer
+
+import (
+	"compliance-form-filler/pkg/language"
+	"testing"
+)
+
+func TestFormatValidatorValidate(t *testing.T) {
+	tests := []struct {
+		name      string
+		validator FormatValidator
+		answer    string
+		want      int
+	}{
+		{name: "no rule", answer: "Data is encrypted at rest.", want: 0},
+		{name: "empty", answer: "  ", want: 1},
+		{name: "no information always valid", validator: FormatValidator{MaxCharacters: 5, Language: language.French}, answer: noInformationAnswer, want: 0},
+		{name: "too many lines", validator: FormatValidator{MaxLines: 2}, answer: "one\n\ntwo\nthree", want: 1},
+		{name: "blank lines not counted", validator: FormatValidator{MaxLines: 2}, answer: "one\n\n\ntwo", want: 0},
+		{name: "too many characters", validator: FormatValidator{MaxCharacters: 10}, answer: "Encrypted with AES-256.", want: 1},
+		{name: "characters counted as runes", validator: FormatValidator{MaxCharacters: 7}, answer: "Sécurité", want: 1},
+		{name: "bare verdict", validator: FormatValidator{ForbidBareVerdict: true}, answer: "Yes.", want: 1},
+		{name: "verdict with justification", validator: FormatValidator{ForbidBareVerdict: true}, answer: "Yes, backups are encrypted.", want: 0},
+		{name: "forbidden phrase", validator: FormatValidator{ForbiddenPhrases: []string{"As an AI", ""}}, answer: "as an ai model, I think so.", want: 1},
+		{name: "wrong language", validator: FormatValidator{Language: language.French}, answer: "The data of the company is encrypted and the keys are rotated.", want: 1},
+		{name: "expected language", validator: FormatValidator{Language: language.French}, answer: "Les données sont chiffrées et les clés sont renouvelées.", want: 0},
+		{name: "abbreviation not a language", validator: FormatValidator{Language: language.English}, answer: "Backups are encrypted, e.g. with AES-256.", want: 0},
+		{
+			name:      "several violations",
+			validator: FormatValidator{MaxLines: 1, MaxCharacters: 10, ForbiddenPhrases: []string{"maybe"}},
+			answer:    "Maybe yes\nmaybe no",
+			want:      3,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.validator.Validate(tt.answer); len(got) != tt.want {
+				t.Errorf("Validate(%q) = %v, want %d violations", tt.answer, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,194 @@
+package answer
+
+import (
+	"compliance-form-filler/pkg/llm"
+	"compliance-form-filler/pkg/logger"
+	"context"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/qdrant/go-client/qdrant"
+)
+
+// Verification modes
+const (
+	VerifyNone    = "none"
+	VerifyLLM     = "llm"
+	VerifyOverlap = "overlap"
+)
+
+// Actions taken on answers failing the verification
+const (
+	VerifyActionDowngrade = "downgrade"
+	VerifyActionReplace   = "replace"
+)
+
+// Minimum share of the content words of a sentence found in the snippets for it to be supported in overlap mode
+const overlapSupportThreshold = 0.6
+
+var (
+	sentenceSplitRegexp = regexp.MustCompile(`[.!?]+(\s+|$)|\n+`)
+	verdictLineRegexp   = regexp.MustCompile(`(?i)^\s*(\d+)\s*[:.)-]\s*(SUPPORTED|UNSUPPORTED)`)
+	stopWords           = map[string]bool{
+		"the": true, "and": true, "for": true, "are": true, "with": true, "that": true, "this": true,
+		"our": true, "all": true, "has": true, "have": true, "from": true, "any": true, "its": true,
+		"not": true, "yes": true, "was": true, "were": true, "which": true, "been": true, "into": true,
+	}
+)
+
+// Verification is the outcome of the groundedness verification of an answer
+type Verification struct {
+	// Supported is true when every sentence of the answer is backed by the snippets
+	Supported bool
+	// Ratio is the share of sentences backed by the snippets
+	Ratio float64
+	// Unsupported lists the sentences not backed by the snippets
+	Unsupported []string
+}
+
+// Reason describes why the verification failed
+func (v Verification) Reason() string {
+	return fmt.Sprintf("unsupported by the retrieved snippets: %s", strings.Join(v.Unsupported, " | "))
+}
+
+// VerifyAnswer checks each sentence of the answer against the snippets, either by asking the LLM or by lexical overlap.
+func VerifyAnswer(ctx context.Context, mode string, llmClient *llm.Client, answer string, points []*qdrant.ScoredPoint) (Verification, error) {
+	sentences := splitSentences(answer)
+	if len(sentences) == 0 || !isApprovedAnswer(answer) {
+		return Verification{Supported: true, Ratio: 1}, nil
+	}
+
+	snippets := snippetTexts(points)
+	var supported []bool
+	var err error
+	switch mode {
+	case VerifyLLM:
+		supported, err = verifyWithLLM(ctx, llmClient, sentences, snippets)
+		if err != nil {
+			return Verification{}, err
+		}
+	case VerifyOverlap:
+		supported = verifyWithOverlap(sentences, snippets)
+	default:
+		return Verification{}, fmt.Errorf("unknown verification mode: %s", mode)
+	}
+
+	verification := Verification{Supported: true}
+	count := 0
+	for index, sentence := range sentences {
+		if supported[index] {
+			count++
+			continue
+		}
+		verification.Supported = false
+		verification.Unsupported = append(verification.Unsupported, sentence)
+	}
+	verification.Ratio = float64(count) / float64(len(sentences))
+	return verification, nil
+}
+
+// verifyWithLLM asks the LLM, in a new conversation, to judge each sentence against the snippets
+func verifyWithLLM(ctx context.Context, llmClient *llm.Client, sentences, snippets []string) ([]bool, error) {
+	var promptBuilder strings.Builder
+	promptBuilder.WriteString("You are a fact checker. For each numbered statement below, tell whether it is fully supported by the snippets.\n")
+	promptBuilder.WriteString("Reply with one line per statement, formatted exactly as \"<number>: SUPPORTED\" or \"<number>: UNSUPPORTED\", and nothing else.\n\n")
+	promptBuilder.WriteString("Snippets:\n")
+	for index, snippet := range snippets {
+		promptBuilder.WriteString(fmt.Sprintf("Snippet %d: %s\n", index+1, snippet))
+	}
+	promptBuilder.WriteString("\nStatements:\n")
+	for index, sentence := range sentences {
+		promptBuilder.WriteString(fmt.Sprintf("%d: %s\n", index+1, sentence))
+	}
+
+	logger.DefaultLogger.Debug().Msgf("Sending verification prompt to LLM: %s", promptBuilder.String())
+	response, err := llmClient.SendMessagesToLLM(ctx, []llm.Message{{Role: llm.RoleUser, Content: promptBuilder.String()}})
+	if err != nil {
+		return nil, fmt.Errorf("failed to send verification prompt to LLM: %w", err)
+	}
+
+	// Statements without a verdict are considered as unsupported
+	supported := make([]bool, len(sentences))
+	for _, line := range strings.Split(response, "\n") {
+		match := verdictLineRegexp.FindStringSubmatch(line)
+		if match == nil {
+			continue
+		}
+		index, err := strconv.Atoi(match[1])
+		if err != nil || index < 1 || index > len(sentences) {
+			continue
+		}
+		supported[index-1] = strings.EqualFold(match[2], "SUPPORTED")
+	}
+	return supported, nil
+}
+
+// verifyWithOverlap considers a sentence as supported when most of its content words appear in a single snippet
+func verifyWithOverlap(sentences, snippets []string) []bool {
+	snippetWords := make([]map[string]bool, len(snippets))
+	for index, snippet := range snippets {
+		snippetWords[index] = make(map[string]bool)
+		for _, word := range contentWords(snippet) {
+			snippetWords[index][word] = true
+		}
+	}
+
+	supported := make([]bool, len(sentences))
+	for index, sentence := range sentences {
+		words := contentWords(sentence)
+		// Sentences without content words, like a bare verdict, carry no claim
+		if len(words) == 0 {
+			supported[index] = true
+			continue
+		}
+		for _, known := range snippetWords {
+			found := 0
+			for _, word := range words {
+				if known[word] {
+					found++
+				}
+			}
+			if float64(found)/float64(len(words)) >= overlapSupportThreshold {
+				supported[index] = true
+				break
+			}
+		}
+	}
+	return supported
+}
+
+func splitSentences(text string) []string {
+	var sentences []string
+	for _, sentence := range sentenceSplitRegexp.Split(text, -1) {
+		sentence = strings.TrimSpace(strings.TrimLeft(sentence, "-*• "))
+		if sentence != "" {
+			sentences = append(sentences, sentence)
+		}
+	}
+	return sentences
+}
+
+func contentWords(text string) []string {
+	var words []string
+	for _, word := range strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	}) {
+		if len([]rune(word)) > 2 && !stopWords[word] {
+			words = append(words, word)
+		}
+	}
+	return words
+}
+
+func snippetTexts(points []*qdrant.ScoredPoint) []string {
+	var texts []string
+	for _, point := range points {
+		if text, ok := point.Payload[qdrantTextFieldName]; ok {
+			texts = append(texts, text.GetStringValue())
+		}
+	}
+	return texts
+}
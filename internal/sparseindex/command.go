@@ -0,0 +1,67 @@
+package sparseindex
+
+import (
+	"compliance-form-filler/pkg/common"
+	"compliance-form-filler/pkg/corpus"
+
+	"context"
+	"fmt"
+	"github.com/urfave/cli/v3"
+)
+
+var Command = &cli.Command{
+	Name:  "index-sparse",
+	Usage: "Compute the keyword sparse vectors of the corpus chunks already ingested in Qdrant, used by hybrid retrieval",
+	Flags: []cli.Flag{
+		&cli.StringFlag{
+			Name:    "qdrant-url",
+			Usage:   "Qdrant URL for vector database",
+			Sources: cli.EnvVars("QDRANT_URL"),
+			Value:   "localhost:6334",
+		},
+		&cli.StringFlag{
+			Name:     "sparse-vector-name",
+			Usage:    "Name of the sparse vector holding the keywords of the chunks",
+			Sources:  cli.EnvVars("SPARSE_VECTOR_NAME"),
+			Required: false,
+			Value:    corpus.SparseVectorName,
+		},
+		&cli.IntFlag{
+			Name:     "batch-size",
+			Usage:    "Number of chunks updated at once",
+			Sources:  cli.EnvVars("BATCH_SIZE"),
+			Required: false,
+			Value:    64,
+		},
+	},
+	Action: func(ctx context.Context, cmd *cli.Command) error {
+		return validateAndExecute(ctx, cmd)
+	},
+}
+
+func ValidateFlags(cmd *cli.Command) error {
+	if cmd.String("qdrant-url") == "" {
+		return fmt.Errorf("qdrant-url is required")
+	}
+	if cmd.String("sparse-vector-name") == "" {
+		return fmt.Errorf("sparse-vector-name is required")
+	}
+	if cmd.Int("batch-size") <= 0 {
+		return fmt.Errorf("batch-size must be strictly positive: %d", cmd.Int("batch-size"))
+	}
+	return nil
+}
+
+func validateAndExecute(ctx context.Context, cmd *cli.Command) error {
+	// Validate global flags
+	if err := common.ValidateCommonFlags(cmd); err != nil {
+		return err
+	}
+
+	// Validate specific flags for this command
+	if err := ValidateFlags(cmd); err != nil {
+		return err
+	}
+
+	return IndexSparse(ctx, cmd)
+}
@@ -0,0 +1,100 @@
+package sparseindex
+
+import (
+	"compliance-form-filler/pkg/common"
+	"compliance-form-filler/pkg/corpus"
+	"compliance-form-filler/pkg/logger"
+	"compliance-form-filler/pkg/sparse"
+	"context"
+	"fmt"
+
+	"github.com/qdrant/go-client/qdrant"
+	"github.com/urfave/cli/v3"
+)
+
+// IndexSparse scrolls through the chunks of the corpus and sets their keyword sparse vector.
+// The collection must declare the sparse vector, with the IDF modifier, when it is created by the ingestor.
+func IndexSparse(ctx context.Context, cmd *cli.Command) error {
+	if cmd == nil {
+		return fmt.Errorf("nil command")
+	}
+	sparseVectorName := cmd.String("sparse-vector-name")
+	batchSize := uint32(cmd.Int("batch-size"))
+
+	qdrantHost, qdrantPort, err := common.ProcessUrl(cmd.String("qdrant-url"))
+	if err != nil {
+		return fmt.Errorf("failed to process Qdrant URL: %w", err)
+	}
+	qdrantClient, err := qdrant.NewClient(&qdrant.Config{
+		Host: qdrantHost,
+		Port: qdrantPort,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to create Qdrant client: %w", err)
+	}
+	defer qdrantClient.Close()
+
+	// Check the collection declares the sparse vector
+	info, err := qdrantClient.GetCollectionInfo(ctx, corpus.CollectionName)
+	if err != nil {
+		return fmt.Errorf("failed to get collection info: %w", err)
+	}
+	params, ok := info.GetConfig().GetParams().GetSparseVectorsConfig().GetMap()[sparseVectorName]
+	if !ok {
+		return fmt.Errorf("collection %s has no sparse vector %q, it must be declared (with the IDF modifier) when the collection is created", corpus.CollectionName, sparseVectorName)
+	}
+	if params.GetModifier() != qdrant.Modifier_Idf {
+		logger.DefaultLogger.Warn().Msgf("Sparse vector %q has no IDF modifier, keyword scores will not account for term rarity", sparseVectorName)
+	}
+
+	logger.DefaultLogger.Info().Msgf("Indexing the keywords of the chunks of %s ...", corpus.CollectionName)
+	var offset *qdrant.PointId
+	indexed := 0
+	for {
+		points, nextOffset, err := qdrantClient.ScrollAndOffset(ctx, &qdrant.ScrollPoints{
+			CollectionName: corpus.CollectionName,
+			Offset:         offset,
+			Limit:          &batchSize,
+			WithPayload:    qdrant.NewWithPayloadInclude(corpus.TextField),
+		})
+		if err != nil {
+			return fmt.Errorf("failed to scroll collection: %w", err)
+		}
+
+		var vectors []*qdrant.PointVectors
+		for _, point := range points {
+			text, ok := point.Payload[corpus.TextField]
+			if !ok {
+				continue
+			}
+			indices, values := sparse.EncodeDocument(text.GetStringValue())
+			vectors = append(vectors, &qdrant.PointVectors{
+				Id: point.GetId(),
+				Vectors: qdrant.NewVectorsMap(map[string]*qdrant.Vector{
+					sparseVectorName: qdrant.NewVectorSparse(indices, values),
+				}),
+			})
+		}
+		if len(vectors) > 0 {
+			wait := true
+			_, err = qdrantClient.UpdateVectors(ctx, &qdrant.UpdatePointVectors{
+				CollectionName: corpus.CollectionName,
+				Wait:           &wait,
+				Points:         vectors,
+			})
+			if err != nil {
+				return fmt.Errorf("failed to update sparse vectors: %w", err)
+			}
+			indexed += len(vectors)
+			logger.DefaultLogger.Info().Msgf("%d chunks indexed", indexed)
+		}
+
+		if nextOffset == nil {
+			break
+		}
+		offset = nextOffset
+	}
+	logger.DefaultLogger.Info().Msgf("Keywords of %d chunks indexed successfully!", indexed)
+
+	return nil
+}
@@ -2,6 +2,7 @@ package app
 
 import (
 	"compliance-form-filler/internal/answer"
+	"compliance-form-filler/internal/sparseindex"
 	"compliance-form-filler/pkg/common"
 	"github.com/urfave/cli/v3"
 )
@@ -12,6 +13,7 @@ func InitApp() *cli.Command {
 		Usage: "EVERTRUST Compliance form Filler",
 		Commands: []*cli.Command{
 			answer.Command,
+			sparseindex.Command,
 		},
 		Flags: common.Flags,
 	}
@@ -3,6 +3,8 @@ package common
 import (
 	"fmt"
 	"github.com/urfave/cli/v3"
+	"strconv"
+	"strings"
 )
 
 var Flags = []cli.Flag{
@@ -40,3 +42,17 @@ func ValidateLogFormat(logFormat string) error {
 		return fmt.Errorf("invalid log format: %s", logFormat)
 	}
 }
+
+// ProcessUrl get host and port from the URL
+func ProcessUrl(url string) (string, int, error) {
+	parts := strings.Split(url, ":")
+	if len(parts) != 2 {
+		return "", 0, fmt.Errorf("invalid URL format, expected 'host:port'")
+	}
+	host := parts[0]
+	port, err := strconv.Atoi(parts[1])
+	if err != nil {
+		return "", 0, fmt.Errorf("invalid port number: %w", err)
+	}
+	return host, port, nil
+}
@@ -0,0 +1,21 @@
+package corpus
+
+// Layout of the Qdrant collection filled by the corpus ingestor
+const (
+	// CollectionName is the name of the collection containing the corpus chunks
+	CollectionName = "compliance_corpus"
+	// TextField is the payload field containing the text of a chunk
+	TextField = "text"
+	// SourceField is the payload field containing the title of the source document of a chunk
+	SourceField = "source"
+	// ChunkIndexField is the payload field containing the position of a chunk in its source document, starting at 0
+	ChunkIndexField = "chunk_index"
+	// FrameworkField is the payload field containing the compliance framework a chunk relates to, e.g. "ISO27001"
+	FrameworkField = "framework"
+	// ProductField is the payload field containing the product a chunk relates to, e.g. "PKI"
+	ProductField = "product"
+	// DocTypeField is the payload field containing the type of the source document of a chunk, e.g. "policy" or "draft"
+	DocTypeField = "doc_type"
+	// SparseVectorName is the name of the sparse vector holding the keywords of a chunk, used by hybrid retrieval
+	SparseVectorName = "keywords"
+)
@@ -2,8 +2,11 @@ package embedding
 
 import (
 	"bytes"
+	"compliance-form-filler/pkg/retry"
+	"context"
 	"encoding/json"
 	"fmt"
+	"io"
 	"net/http"
 )
 
@@ -15,26 +18,59 @@ type EmbedResponse struct {
 	Vectors [][]float32 `json:"vectors"`
 }
 
-func EmbedString(str string, url string) ([]float32, error) {
+func EmbedString(ctx context.Context, str string, url string) ([]float32, error) {
 	payload, err := json.Marshal(EmbedRequest{Texts: []string{str}})
 	if err != nil {
 		return nil, err
 	}
 
-	resp, err := http.Post(url, "application/json", bytes.NewBuffer(payload))
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewBuffer(payload))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create embedding request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := http.DefaultClient.Do(req)
 	if err != nil {
 		return nil, fmt.Errorf("failed to reach embedding API: %w", err)
 	}
 	defer resp.Body.Close()
 
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return nil, fmt.Errorf("embedding API responded with: %w", &retry.StatusError{StatusCode: resp.StatusCode, Body: string(body)})
+	}
+
 	var res EmbedResponse
 	if err := json.NewDecoder(resp.Body).Decode(&res); err != nil {
 		return nil, fmt.Errorf("invalid embedding response: %w", err)
 	}
 
 	if len(res.Vectors) == 0 {
-		return nil, fmt.Errorf("no embedding returned")
+		return nil, retry.Permanent(fmt.Errorf("no embedding returned"))
 	}
 
 	return res.Vectors[0], nil
 }
+
+// Client embeds strings through the embedding API, retrying transient failures
+type Client struct {
+	URL     string
+	Breaker *retry.Breaker
+}
+
+// NewClient creates a client for the given embedding API, protected by the breaker
+func NewClient(url string, breaker *retry.Breaker) *Client {
+	return &Client{URL: url, Breaker: breaker}
+}
+
+// Embed returns the vector of the string, retrying according to the breaker policy
+func (c *Client) Embed(ctx context.Context, str string) ([]float32, error) {
+	var vector []float32
+	err := c.Breaker.Do(ctx, func(ctx context.Context) error {
+		var err error
+		vector, err = EmbedString(ctx, str, c.URL)
+		return err
+	})
+	return vector, err
+}
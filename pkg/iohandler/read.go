@@ -2,26 +2,70 @@ package iohandler
 
 import (
 	"bufio"
+	"encoding/csv"
 	"fmt"
 	"os"
+	"regexp"
+	"strconv"
 	"strings"
 )
 
-// ReadFile reads a file and returns its content as a slice of strings.
-// WARNING: We assume one line is one question to be asked to the LLM.
-func ReadFile(filePath string) ([]string, error) {
+// sectionPrefix starts the lines holding a section heading, like "# Access Control"
+const sectionPrefix = "#"
+
+// Types of questions
+const (
+	// QuestionTypeText expects a free text answer
+	QuestionTypeText = "text"
+	// QuestionTypeChoice expects exactly one of the options
+	QuestionTypeChoice = "choice"
+	// QuestionTypeSelectAll expects one or several of the options
+	QuestionTypeSelectAll = "select-all"
+)
+
+const (
+	// OptionsSeparator separates the options of a choice question, in the source and output files
+	OptionsSeparator = " | "
+	// SelectedSeparator separates the options selected for a question, in the output file
+	SelectedSeparator = "; "
+)
+
+// optionsRegexp matches the options ending a choice question, like "{choice: Yes | No | Partially}"
+var optionsRegexp = regexp.MustCompile(`^(.*?)\s*\{\s*(choice|select-all)\s*:\s*([^{}]+)\}\s*$`)
+
+// Question is a question of the questionnaire, along with the section it belongs to
+type Question struct {
+	Text    string
+	Section string
+	// Type is the kind of answer expected, Options listing the allowed ones for choice and select-all questions
+	Type    string
+	Options []string
+	// Language is the ISO 639-1 code of the language detected in the question, empty when unknown or not detected yet
+	Language string
+}
+
+// ReadFile reads a file and returns the questions it contains.
+// WARNING: We assume one line is one question to be asked to the LLM, except the lines starting with "#"
+// which are section headings applying to the next questions.
+// A question may end with its allowed options, as "{choice: A | B}" for a single one or "{select-all: A | B}" for several.
+func ReadFile(filePath string) ([]Question, error) {
 	file, err := os.Open(filePath)
 	if err != nil {
 		return nil, fmt.Errorf("failed to open file: %w", err)
 	}
 	defer file.Close()
 
-	var questions []string
+	var questions []Question
+	section := ""
 	scanner := bufio.NewScanner(file)
 	for scanner.Scan() {
 		line := strings.TrimSpace(scanner.Text())
+		if strings.HasPrefix(line, sectionPrefix) {
+			section = strings.TrimSpace(strings.TrimLeft(line, sectionPrefix))
+			continue
+		}
 		if line != "" {
-			questions = append(questions, line)
+			questions = append(questions, parseQuestion(line, section))
 		}
 	}
 
@@ -31,3 +75,106 @@ func ReadFile(filePath string) ([]string, error) {
 
 	return questions, nil
 }
+
+// parseQuestion extracts the type and the options of a question line
+func parseQuestion(line, section string) Question {
+	question := Question{Text: line, Section: section, Type: QuestionTypeText}
+	match := optionsRegexp.FindStringSubmatch(line)
+	if match == nil {
+		return question
+	}
+	var options []string
+	for _, option := range strings.Split(match[3], strings.TrimSpace(OptionsSeparator)) {
+		if option = strings.TrimSpace(option); option != "" {
+			options = append(options, option)
+		}
+	}
+	if len(options) < 2 {
+		return question
+	}
+	question.Text, question.Type, question.Options = match[1], match[2], options
+	return question
+}
+
+// PreviousAnswer is a row of a CSV file previously generated by WriteFile
+type PreviousAnswer struct {
+	Section  string
+	Question string
+	// Type and Options are empty for files written before the Question Type and Options columns
+	Type     string
+	Options  []string
+	Answer   string
+	Selected []string
+	Verdict  string
+	// Status is empty for files written before the Status column
+	Status      string
+	NeedsReview bool
+}
+
+// ReadAnswers reads a CSV file previously generated by WriteFile and returns its rows, and whether it has a Section column.
+// Columns are located by their header, files written before the Section column starting with Question and Answer.
+func ReadAnswers(filePath string) ([]PreviousAnswer, bool, error) {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to open file: %w", err)
+	}
+	defer file.Close()
+
+	reader := csv.NewReader(file)
+	// Older files have fewer columns
+	reader.FieldsPerRecord = -1
+	records, err := reader.ReadAll()
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to parse CSV file: %w", err)
+	}
+	if len(records) == 0 {
+		return nil, false, fmt.Errorf("empty CSV file")
+	}
+
+	columns := map[string]int{"Question": 0, "Answer": 1}
+	for index, name := range records[0] {
+		columns[name] = index
+	}
+	field := func(record []string, name string) string {
+		index, ok := columns[name]
+		if !ok || index >= len(record) {
+			return ""
+		}
+		return record[index]
+	}
+
+	var answers []PreviousAnswer
+	// skip the header
+	for _, record := range records[1:] {
+		if len(record) <= max(columns["Question"], columns["Answer"]) {
+			continue
+		}
+		needsReview, _ := strconv.ParseBool(field(record, "Needs Review"))
+		answers = append(answers, PreviousAnswer{
+			Section:     field(record, "Section"),
+			Question:    field(record, "Question"),
+			Type:        field(record, "Question Type"),
+			Options:     splitList(field(record, "Options"), OptionsSeparator),
+			Answer:      field(record, "Answer"),
+			Selected:    splitList(field(record, "Selected Options"), SelectedSeparator),
+			Verdict:     field(record, "Verdict"),
+			Status:      field(record, "Status"),
+			NeedsReview: needsReview,
+		})
+	}
+
+	_, hasSection := columns["Section"]
+	return answers, hasSection, nil
+}
+
+// splitList splits a list written by WriteFile, returning nil for an empty field
+func splitList(field, separator string) []string {
+	if strings.TrimSpace(field) == "" {
+		return nil
+	}
+	values := strings.Split(field, separator)
+	for index, value := range values {
+		values[index] = strings.TrimSpace(value)
+	}
+	return values
+}
@@ -0,0 +1,53 @@
+package iohandler
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestParseQuestion(t *testing.T) {
+	tests := []struct {
+		name        string
+		line        string
+		wantText    string
+		wantType    string
+		wantOptions []string
+	}{
+		{name: "text", line: "Is data encrypted at rest?", wantText: "Is data encrypted at rest?", wantType: QuestionTypeText},
+		{
+			name:        "choice",
+			line:        "Is data encrypted at rest? {choice: Yes | No | Partially}",
+			wantText:    "Is data encrypted at rest?",
+			wantType:    QuestionTypeChoice,
+			wantOptions: []string{"Yes", "No", "Partially"},
+		},
+		{
+			name:        "select-all with spaces",
+			line:        "Which frameworks do you comply with?  { select-all :ISO 27001|SOC 2 | PCI DSS } ",
+			wantText:    "Which frameworks do you comply with?",
+			wantType:    QuestionTypeSelectAll,
+			wantOptions: []string{"ISO 27001", "SOC 2", "PCI DSS"},
+		},
+		{
+			name:        "empty options dropped",
+			line:        "Is MFA enforced? {choice: Yes | | No |}",
+			wantText:    "Is MFA enforced?",
+			wantType:    QuestionTypeChoice,
+			wantOptions: []string{"Yes", "No"},
+		},
+		{name: "single option", line: "Is MFA enforced? {choice: Yes}", wantText: "Is MFA enforced? {choice: Yes}", wantType: QuestionTypeText},
+		{name: "unknown type", line: "Is MFA enforced? {pick: Yes | No}", wantText: "Is MFA enforced? {pick: Yes | No}", wantType: QuestionTypeText},
+		{name: "options not at the end", line: "Is MFA {choice: Yes | No} enforced?", wantText: "Is MFA {choice: Yes | No} enforced?", wantType: QuestionTypeText},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			question := parseQuestion(tt.line, "Access")
+			if question.Text != tt.wantText || question.Type != tt.wantType || !slices.Equal(question.Options, tt.wantOptions) {
+				t.Errorf("parseQuestion() = %q, %q, %v, want %q, %q, %v", question.Text, question.Type, question.Options, tt.wantText, tt.wantType, tt.wantOptions)
+			}
+			if question.Section != "Access" {
+				t.Errorf("parseQuestion() section = %q, want %q", question.Section, "Access")
+			}
+		})
+	}
+}
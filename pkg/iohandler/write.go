@@ -2,19 +2,74 @@ package iohandler
 
 import (
 	"bufio"
+	"compliance-form-filler/pkg/llm"
+	"encoding/json"
 	"fmt"
 	"os"
+	"path/filepath"
 	"strings"
+	"time"
 )
 
+// Statuses of a result
+const (
+	StatusAnswered      = "answered"
+	StatusNoInformation = "no-information"
+	StatusCarriedOver   = "carried-over"
+	StatusError         = "error"
+	StatusNotProcessed  = "not-processed"
+	StatusNotApplicable = "not-applicable"
+)
+
+// Evidence is a snippet given to the LLM to answer a question
+type Evidence struct {
+	Source string
+	// Score is the retrieval score, RerankScore the score given by the reranker if any
+	Score       float64
+	RerankScore *float64
+}
+
+// String formats the evidence as "source (score: 0.82, rerank: 0.91)"
+func (e Evidence) String() string {
+	if e.RerankScore != nil {
+		return fmt.Sprintf("%s (score: %.2f, rerank: %.2f)", e.Source, e.Score, *e.RerankScore)
+	}
+	return fmt.Sprintf("%s (score: %.2f)", e.Source, e.Score)
+}
+
+// Result is the answer to a question, as written in the output file
+type Result struct {
+	// Section is the heading of the questionnaire section of the question, if any
+	Section  string
+	Question string
+	// Type is the kind of answer expected, Options listing the allowed ones for choice and select-all questions
+	Type    string
+	Options []string
+	// Language is the ISO 639-1 code of the language detected in the question, empty when unknown
+	Language string
+	Answer   string
+	// Selected lists the options chosen for choice and select-all questions
+	Selected    []string
+	Status      string
+	Confidence  float64
+	NeedsReview bool
+	// Verdict and CitedSources are only filled for structured answers
+	Verdict      string
+	CitedSources []string
+	// Evidence lists the snippets given to the LLM
+	Evidence []Evidence
+	// Notes explains why an answer was altered or flagged
+	Notes string
+}
+
 // escapeCSVField escapes a field for CSV output by doubling quotes and wrapping the field in quotes, so that if it contains commas or newlines, it will be correctly interpreted by CSV parsers.
 func escapeCSVField(field string) string {
 	field = strings.ReplaceAll(field, `"`, `""`)
 	return `"` + field + `"`
 }
 
-// WriteFile generates the CSV file providing responses to the questions
-func WriteFile(destPath string, answers map[string]string) error {
+// WriteFile generates the CSV file providing responses to the questions, in the order of the results
+func WriteFile(destPath string, results []Result) error {
 	file, err := os.Create(destPath)
 	if err != nil {
 		return fmt.Errorf("failed to create file: %w", err)
@@ -23,13 +78,21 @@ func WriteFile(destPath string, answers map[string]string) error {
 
 	writer := bufio.NewWriter(file)
 	// write the header
-	if _, err = writer.WriteString("Question,Answer\n"); err != nil {
+	if _, err = writer.WriteString("Section,Question,Question Type,Options,Language,Answer,Selected Options,Status,Confidence,Needs Review,Verdict,Cited Sources,Evidence,Notes\n"); err != nil {
 		return fmt.Errorf("failed to write header to file: %w", err)
 	}
-	for question, answer := range answers {
-		escapedQuestion := escapeCSVField(question)
-		escapedAnswer := escapeCSVField(answer)
-		if _, err = writer.WriteString(fmt.Sprintf("%s,%s\n", escapedQuestion, escapedAnswer)); err != nil {
+	for _, result := range results {
+		escapedQuestion := escapeCSVField(result.Question)
+		escapedAnswer := escapeCSVField(result.Answer)
+		escapedVerdict := escapeCSVField(result.Verdict)
+		escapedSources := escapeCSVField(strings.Join(result.CitedSources, "; "))
+		var evidence []string
+		for _, item := range result.Evidence {
+			evidence = append(evidence, item.String())
+		}
+		escapedEvidence := escapeCSVField(strings.Join(evidence, "; "))
+		escapedNotes := escapeCSVField(result.Notes)
+		if _, err = writer.WriteString(fmt.Sprintf("%s,%s,%s,%s,%s,%s,%s,%s,%.2f,%t,%s,%s,%s,%s\n", escapeCSVField(result.Section), escapedQuestion, escapeCSVField(result.Type), escapeCSVField(strings.Join(result.Options, OptionsSeparator)), escapeCSVField(result.Language), escapedAnswer, escapeCSVField(strings.Join(result.Selected, SelectedSeparator)), escapeCSVField(result.Status), result.Confidence, result.NeedsReview, escapedVerdict, escapedSources, escapedEvidence, escapedNotes)); err != nil {
 			return fmt.Errorf("failed to write to file: %w", err)
 		}
 	}
@@ -40,3 +103,34 @@ func WriteFile(destPath string, answers map[string]string) error {
 
 	return nil
 }
+
+// RunMetadata describes how the answers of a run were generated
+type RunMetadata struct {
+	StartedAt     time.Time `json:"started_at"`
+	SourceFile    string    `json:"source_file"`
+	PromptVersion string    `json:"prompt_version"`
+	PromptHash    string    `json:"prompt_hash"`
+	// Interrupted is true when the run was stopped before all questions were processed
+	Interrupted bool        `json:"interrupted"`
+	LLMModel    string      `json:"llm_model"`
+	LLMOptions  llm.Options `json:"llm_options"`
+	// Filters are the payload filter conditions applied to every search
+	Filters []string `json:"filters,omitempty"`
+}
+
+// MetadataPath returns the path of the metadata file written along the given output file
+func MetadataPath(destPath string) string {
+	return strings.TrimSuffix(destPath, filepath.Ext(destPath)) + ".meta.json"
+}
+
+// WriteMetadata saves the metadata of the run next to the output file
+func WriteMetadata(destPath string, metadata RunMetadata) error {
+	data, err := json.MarshalIndent(metadata, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal metadata: %w", err)
+	}
+	if err = os.WriteFile(MetadataPath(destPath), data, 0644); err != nil {
+		return fmt.Errorf("failed to write metadata file: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,91 @@
+package language
+
+import (
+	"regexp"
+	"strings"
+	"unicode"
+)
+
+// Supported languages, as ISO 639-1 codes
+const (
+	English = "en"
+	French  = "fr"
+	German  = "de"
+	Spanish = "es"
+	Italian = "it"
+)
+
+// Names maps the supported languages to their English name, to be used in prompts
+var Names = map[string]string{
+	English: "English",
+	French:  "French",
+	German:  "German",
+	Spanish: "Spanish",
+	Italian: "Italian",
+}
+
+// stopWords lists the most frequent words of each supported language.
+// One-letter words are left out, being too easily found in abbreviations and list markers.
+var stopWords = map[string][]string{
+	English: {"the", "and", "is", "are", "of", "to", "in", "do", "does", "you", "your", "for", "with", "how", "what", "have", "has", "be", "this", "that", "on", "any", "all"},
+	French:  {"le", "la", "les", "et", "est", "sont", "des", "du", "de", "un", "une", "vous", "votre", "vos", "pour", "avec", "comment", "quel", "quelle", "avez", "dans", "sur", "ce", "cette", "que", "qui"},
+	German:  {"der", "die", "das", "und", "ist", "sind", "ein", "eine", "sie", "ihr", "ihre", "für", "mit", "wie", "was", "haben", "werden", "wird", "den", "dem", "des", "nicht", "auf", "im", "es", "einen", "einer", "gibt", "zu", "von", "bei", "wir", "oder", "auch"},
+	Spanish: {"el", "la", "los", "las", "es", "son", "de", "del", "un", "una", "usted", "su", "sus", "para", "con", "cómo", "qué", "tiene", "en", "por", "que", "se"},
+	Italian: {"il", "lo", "la", "gli", "le", "è", "sono", "di", "del", "della", "un", "una", "voi", "vostro", "per", "con", "come", "che", "avete", "nel", "sul", "questo"},
+}
+
+// abbreviationRegexp matches dotted abbreviations such as "e.g." or "i.e.", whose letters are not words
+var abbreviationRegexp = regexp.MustCompile(`(?i)\b(?:\pL\.){2,}`)
+
+// minScore is the number of stop words required to detect a language other than English,
+// and minMargin the number of stop words it must have over English
+const (
+	minScore  = 2
+	minMargin = 2
+)
+
+// Detect returns the most likely language of the text, based on stop words frequency.
+// Languages other than English are only reported when detected with confidence, English being
+// the default language of questionnaires. It returns an empty string when no language could be detected.
+func Detect(text string) string {
+	text = abbreviationRegexp.ReplaceAllString(text, " ")
+	words := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r)
+	})
+
+	scores := make(map[string]int)
+	for lang, list := range stopWords {
+		known := make(map[string]bool, len(list))
+		for _, word := range list {
+			known[word] = true
+		}
+		for _, word := range words {
+			if known[word] {
+				scores[lang]++
+			}
+		}
+	}
+
+	best := ""
+	bestScore := 0
+	// iterate in a fixed order so that ties are resolved deterministically, English first
+	for _, lang := range []string{English, French, German, Spanish, Italian} {
+		if scores[lang] > bestScore {
+			best = lang
+			bestScore = scores[lang]
+		}
+	}
+	if best != English && best != "" && (bestScore < minScore || bestScore-scores[English] < minMargin) {
+		if scores[English] > 0 {
+			return English
+		}
+		return ""
+	}
+	return best
+}
+
+// IsSupported tells whether the language code is supported
+func IsSupported(lang string) bool {
+	_, ok := Names[lang]
+	return ok
+}
@@ -0,0 +1,45 @@
+package language
+
+import "testing"
+
+func TestDetect(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+		want string
+	}{
+		{name: "english", text: "Do you encrypt the data of your customers?", want: English},
+		{name: "french", text: "Avez-vous une politique de sécurité ?", want: French},
+		{name: "german", text: "Haben Sie eine Richtlinie für die Sicherheit?", want: German},
+		{name: "short german", text: "Gibt es einen Notfallplan?", want: German},
+		{name: "german without pronoun", text: "Werden Zugriffe auf Daten regelmäßig überprüft?", want: German},
+		{name: "german with wir", text: "Sollen wir einen Bericht von jedem Audit erstellen?", want: German},
+		{name: "spanish", text: "¿Tiene usted una política de seguridad?", want: Spanish},
+		{name: "italian", text: "Il personale è formato sulla sicurezza?", want: Italian},
+		{name: "english with abbreviation", text: "Do you encrypt backups, e.g. database dumps?", want: English},
+		{name: "english with several abbreviations", text: "List the controls, i.e. e.g. MFA and SSO.", want: English},
+		{name: "one-letter words ignored", text: "Encryption y rotation e backups", want: ""},
+		{name: "not enough stop words", text: "Describe la procedure", want: ""},
+		{name: "not enough margin over english", text: "Is the policy de facto in place?", want: English},
+		{name: "no stop word", text: "MFA enforced?", want: ""},
+		{name: "empty", text: "", want: ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Detect(tt.text); got != tt.want {
+				t.Errorf("Detect(%q) = %q, want %q", tt.text, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestIsSupported(t *testing.T) {
+	for _, lang := range []string{English, French, German, Spanish, Italian} {
+		if !IsSupported(lang) {
+			t.Errorf("IsSupported(%q) = false, want true", lang)
+		}
+	}
+	if IsSupported("nl") {
+		t.Errorf("IsSupported(%q) = true, want false", "nl")
+	}
+}
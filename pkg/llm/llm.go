@@ -3,25 +3,55 @@ package llm
 import (
 	"bytes"
 	"compliance-form-filler/pkg/logger"
+	"compliance-form-filler/pkg/retry"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"io/ioutil"
+	"io"
 	"net/http"
 	"regexp"
 	"strings"
+	"time"
 )
 
-type GenerateRequest struct {
-	Model   string `json:"model"`
-	Prompt  string `json:"prompt"`
-	Stream  bool   `json:"stream"`
-	Context []int  `json:"context"`
+// Roles of the chat messages
+const (
+	RoleSystem    = "system"
+	RoleUser      = "user"
+	RoleAssistant = "assistant"
+)
+
+type Message struct {
+	Role    string `json:"role"`
+	Content string `json:"content"`
+}
+
+// DefaultModel is the model used when none is given
+const DefaultModel = "deepseek-r1:8b"
+
+// Options are the generation options passed to the model, unset options keep the model defaults
+type Options struct {
+	Temperature *float64 `json:"temperature,omitempty"`
+	TopP        *float64 `json:"top_p,omitempty"`
+	Seed        *int     `json:"seed,omitempty"`
+	NumCtx      int      `json:"num_ctx,omitempty"`
+	NumPredict  int      `json:"num_predict,omitempty"`
+	Stop        []string `json:"stop,omitempty"`
 }
 
-type GenerateResponse struct {
-	Response string `json:"response"`
-	Done     bool   `json:"done"`
-	Context  []int  `json:"context,omitempty"`
+type ChatRequest struct {
+	Model    string    `json:"model"`
+	Messages []Message `json:"messages"`
+	Stream   bool      `json:"stream"`
+	// Format constrains the output, either "json" or a JSON schema
+	Format  json.RawMessage `json:"format,omitempty"`
+	Options *Options        `json:"options,omitempty"`
+}
+
+type ChatResponse struct {
+	Message Message `json:"message"`
+	Done    bool    `json:"done"`
 }
 
 func DeepSeekPostProcessResponse(response string) string {
@@ -40,41 +70,178 @@ func DeepSeekPostProcessResponse(response string) string {
 	return cleaned
 }
 
-func SendPromptToLLM(url, prompt string, context []int) (string, []int, error) {
-	reqBody := GenerateRequest{
-		Model:   "deepseek-r1:8b",
-		Prompt:  prompt,
-		Stream:  false,
-		Context: context,
+// ErrFirstTokenTimeout is returned when the LLM does not start answering within the first token timeout
+var ErrFirstTokenTimeout = errors.New("no token received from the LLM before the first token timeout")
+
+// Client sends conversations to the chat endpoint of the LLM, with the same model and options
+type Client struct {
+	URL     string
+	Model   string
+	Options Options
+	// Stream receives the reply token by token, calling OnToken for each of them
+	Stream  bool
+	OnToken func(token string)
+	// FirstTokenTimeout bounds the wait for the first token, only in streaming mode, 0 to disable
+	FirstTokenTimeout time.Duration
+	// Timeout bounds the whole request, 0 to disable
+	Timeout time.Duration
+	// Breaker retries the failed requests and fails fast when the LLM is down, nil to disable
+	Breaker *retry.Breaker
+}
+
+// NewClient creates a client for the given chat endpoint, using the default model if none is given
+func NewClient(url, model string, options Options) *Client {
+	if model == "" {
+		model = DefaultModel
 	}
+	return &Client{URL: url, Model: model, Options: options}
+}
+
+// SendMessagesToLLM sends the conversation to the chat endpoint of the LLM and returns the content of its reply
+func (c *Client) SendMessagesToLLM(ctx context.Context, messages []Message) (string, error) {
+	return c.sendChatRequest(ctx, ChatRequest{
+		Model:    c.Model,
+		Messages: messages,
+		Stream:   c.Stream,
+		Options:  &c.Options,
+	})
+}
+
+// SendStructuredMessagesToLLM sends the conversation to the LLM, whose reply must follow the given JSON schema
+func (c *Client) SendStructuredMessagesToLLM(ctx context.Context, messages []Message, schema json.RawMessage) (string, error) {
+	return c.sendChatRequest(ctx, ChatRequest{
+		Model:    c.Model,
+		Messages: messages,
+		Stream:   c.Stream,
+		Format:   schema,
+		Options:  &c.Options,
+	})
+}
 
+func (c *Client) sendChatRequest(ctx context.Context, reqBody ChatRequest) (string, error) {
+	if c.Breaker == nil {
+		return c.sendChatRequestOnce(ctx, reqBody, c.OnToken)
+	}
+	// The tokens already passed to OnToken by a failed attempt are not passed again when a retry replays them
+	var printed string
+	var response string
+	err := c.Breaker.Do(ctx, func(ctx context.Context) error {
+		var onToken func(token string)
+		if c.OnToken != nil {
+			var received string
+			onToken = func(token string) {
+				received += token
+				switch {
+				case strings.HasPrefix(printed, received):
+				case strings.HasPrefix(received, printed):
+					c.OnToken(received[len(printed):])
+					printed = received
+				default:
+					// The retry diverges from the failed attempt, its reply starts over on a new line
+					c.OnToken("\n" + received)
+					printed = received
+				}
+			}
+		}
+		var err error
+		response, err = c.sendChatRequestOnce(ctx, reqBody, onToken)
+		return err
+	})
+	return response, err
+}
+
+func (c *Client) sendChatRequestOnce(ctx context.Context, reqBody ChatRequest, onToken func(token string)) (string, error) {
 	jsonData, err := json.Marshal(reqBody)
 	if err != nil {
-		return "", []int{}, fmt.Errorf("failed to marshal prompt: %w", err)
+		return "", retry.Permanent(fmt.Errorf("failed to marshal messages: %w", err))
 	}
 
-	resp, err := http.Post(url, "application/json", bytes.NewBuffer(jsonData))
+	if c.Timeout > 0 {
+		var cancelTimeout context.CancelFunc
+		ctx, cancelTimeout = context.WithTimeout(ctx, c.Timeout)
+		defer cancelTimeout()
+	}
+	ctx, cancel := context.WithCancelCause(ctx)
+	defer cancel(nil)
+	// The first token timer is stopped as soon as the first chunk of the stream is received
+	stopFirstTokenTimer := func() {}
+	if reqBody.Stream && c.FirstTokenTimeout > 0 {
+		firstTokenTimer := time.AfterFunc(c.FirstTokenTimeout, func() { cancel(ErrFirstTokenTimeout) })
+		defer firstTokenTimer.Stop()
+		stopFirstTokenTimer = func() { firstTokenTimer.Stop() }
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.URL, bytes.NewBuffer(jsonData))
+	if err != nil {
+		return "", fmt.Errorf("failed to create LLM request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := http.DefaultClient.Do(req)
 	if err != nil {
-		return "", []int{}, fmt.Errorf("failed to send request to LLM: %w", err)
+		return "", fmt.Errorf("failed to send request to LLM: %w", contextError(ctx, err))
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
-		body, _ := ioutil.ReadAll(resp.Body)
-		return "", []int{}, fmt.Errorf("LLM responded with status %d: %s", resp.StatusCode, string(body))
+		body, _ := io.ReadAll(resp.Body)
+		return "", fmt.Errorf("LLM responded with: %w", &retry.StatusError{StatusCode: resp.StatusCode, Body: string(body)})
 	}
 
-	var result GenerateResponse
-	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
-		return "", []int{}, fmt.Errorf("failed to decode LLM response: %w", err)
+	var content string
+	if reqBody.Stream {
+		content, err = readStream(ctx, resp.Body, stopFirstTokenTimer, onToken)
+		if err != nil {
+			return "", err
+		}
+	} else {
+		var result ChatResponse
+		if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+			return "", fmt.Errorf("failed to decode LLM response: %w", contextError(ctx, err))
+		}
+		if !result.Done {
+			return "", retry.Permanent(fmt.Errorf("LLM response generation not done: %s", result.Message.Content))
+		}
+		content = result.Message.Content
 	}
 
-	if !result.Done {
-		return "", []int{}, fmt.Errorf("LLM response generation not done: %s", result.Response)
-	}
 	logger.DefaultLogger.Info().Msgf("Post-process LLM response...")
-	result.Response = DeepSeekPostProcessResponse(result.Response)
+	response := DeepSeekPostProcessResponse(content)
 	logger.DefaultLogger.Info().Msgf("LLM response post-processed")
 
-	return result.Response, result.Context, nil
+	return response, nil
+}
+
+// readStream reads the chunks of a streamed reply until the last one, passing their content to onToken if not nil,
+// and returns the whole content
+func readStream(ctx context.Context, body io.Reader, onFirstChunk func(), onToken func(token string)) (string, error) {
+	var content strings.Builder
+	decoder := json.NewDecoder(body)
+	for first := true; ; first = false {
+		var chunk ChatResponse
+		if err := decoder.Decode(&chunk); err != nil {
+			if err == io.EOF {
+				return "", fmt.Errorf("LLM stream ended before the response was done: %s", content.String())
+			}
+			return "", fmt.Errorf("failed to decode LLM stream: %w", contextError(ctx, err))
+		}
+		if first {
+			onFirstChunk()
+		}
+		content.WriteString(chunk.Message.Content)
+		if onToken != nil && chunk.Message.Content != "" {
+			onToken(chunk.Message.Content)
+		}
+		if chunk.Done {
+			return content.String(), nil
+		}
+	}
+}
+
+// contextError returns the reason why the context was cancelled, if it was, or the original error otherwise
+func contextError(ctx context.Context, err error) error {
+	if cause := context.Cause(ctx); cause != nil {
+		return cause
+	}
+	return err
 }
@@ -0,0 +1,58 @@
+package llm
+
+import (
+	"compliance-form-filler/pkg/retry"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestStreamRetryPrintsTokensOnce(t *testing.T) {
+	tests := []struct {
+		name    string
+		replies [][]string
+		want    string
+	}{
+		{name: "no retry", replies: [][]string{{"Data is ", "encrypted."}}, want: "Data is encrypted."},
+		{name: "retry replays the failed attempt", replies: [][]string{{"Data is "}, {"Data is ", "encrypted."}}, want: "Data is encrypted."},
+		{name: "retry diverges", replies: [][]string{{"Data was "}, {"Data is ", "encrypted."}}, want: "Data was \nData is encrypted."},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			attempt := 0
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				chunks := tt.replies[attempt]
+				attempt++
+				encoder := json.NewEncoder(w)
+				for _, chunk := range chunks {
+					_ = encoder.Encode(ChatResponse{Message: Message{Role: RoleAssistant, Content: chunk}})
+				}
+				// Only the last attempt completes the stream, the others being cut off
+				if attempt == len(tt.replies) {
+					_ = encoder.Encode(ChatResponse{Done: true})
+				}
+			}))
+			defer server.Close()
+
+			client := NewClient(server.URL, "", Options{})
+			client.Stream = true
+			client.Breaker = retry.NewBreaker("LLM", 0, retry.Policy{MaxAttempts: len(tt.replies)})
+			var printed strings.Builder
+			client.OnToken = func(token string) { printed.WriteString(token) }
+
+			response, err := client.SendMessagesToLLM(context.Background(), []Message{{Role: RoleUser, Content: "Is data encrypted?"}})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if response != "Data is encrypted." {
+				t.Errorf("SendMessagesToLLM() = %q, want %q", response, "Data is encrypted.")
+			}
+			if printed.String() != tt.want {
+				t.Errorf("printed tokens = %q, want %q", printed.String(), tt.want)
+			}
+		})
+	}
+}
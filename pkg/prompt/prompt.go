@@ -0,0 +1,131 @@
+package prompt
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"embed"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"text/template"
+)
+
+const (
+	// SystemTemplateName is the file name of the template describing the task to the LLM
+	SystemTemplateName = "system.tmpl"
+	// QuestionTemplateName is the file name of the template presenting the snippets and the question
+	QuestionTemplateName = "question.tmpl"
+)
+
+// defaultTemplates are the built-in templates, used when no template directory is given
+//
+//go:embed templates/*.tmpl
+var defaultTemplates embed.FS
+
+// versionRegexp extracts the version declared in a template, as {{/* version: 1.0.0 */}}
+var versionRegexp = regexp.MustCompile(`\{\{/\*\s*version:\s*([^\s*]+)\s*\*/`)
+
+// Variables are the values available in every template
+type Variables struct {
+	CompanyName   string
+	Product       string
+	Questionnaire string
+}
+
+// Snippet is a search result presented to the LLM
+type Snippet struct {
+	Index  int
+	Text   string
+	Score  float32
+	Source string
+}
+
+// QuestionData is the data available in the question template
+type QuestionData struct {
+	Variables
+	Snippets []Snippet
+	Question string
+	// Section is the heading of the questionnaire section of the question, if any
+	Section string
+	// AnswerLanguage is the name of the language the answer must be written in, empty to keep the default
+	AnswerLanguage string
+}
+
+// Templates are the parsed prompt templates
+type Templates struct {
+	system   *template.Template
+	question *template.Template
+	// Version is the version declared by the system template
+	Version string
+	// Hash identifies the content of all templates
+	Hash string
+}
+
+// Load parses the templates from the given directory. Templates missing from the directory,
+// or all of them when the directory is empty, fall back to the built-in ones.
+func Load(dir string) (*Templates, error) {
+	hash := sha256.New()
+	templates := &Templates{}
+	for _, name := range []string{SystemTemplateName, QuestionTemplateName} {
+		content, err := readTemplate(dir, name)
+		if err != nil {
+			return nil, err
+		}
+		hash.Write(content)
+
+		parsed, err := template.New(name).Parse(string(content))
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse template %s: %w", name, err)
+		}
+		switch name {
+		case SystemTemplateName:
+			templates.system = parsed
+			if match := versionRegexp.FindSubmatch(content); match != nil {
+				templates.Version = string(match[1])
+			}
+		case QuestionTemplateName:
+			templates.question = parsed
+		}
+	}
+	templates.Hash = hex.EncodeToString(hash.Sum(nil))[:12]
+
+	return templates, nil
+}
+
+func readTemplate(dir, name string) ([]byte, error) {
+	if dir != "" {
+		content, err := os.ReadFile(filepath.Join(dir, name))
+		if err == nil {
+			return content, nil
+		}
+		if !os.IsNotExist(err) {
+			return nil, fmt.Errorf("failed to read template %s: %w", name, err)
+		}
+	}
+	content, err := defaultTemplates.ReadFile("templates/" + name)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read built-in template %s: %w", name, err)
+	}
+	return content, nil
+}
+
+// System renders the task description sent to the LLM before the questions
+func (t *Templates) System(vars Variables) (string, error) {
+	return render(t.system, vars)
+}
+
+// Question renders the prompt asking a question along with its snippets
+func (t *Templates) Question(data QuestionData) (string, error) {
+	return render(t.question, data)
+}
+
+func render(tmpl *template.Template, data any) (string, error) {
+	var buffer bytes.Buffer
+	if err := tmpl.Execute(&buffer, data); err != nil {
+		return "", fmt.Errorf("failed to render template %s: %w", tmpl.Name(), err)
+	}
+	return strings.TrimSpace(buffer.String()), nil
+}
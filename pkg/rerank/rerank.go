@@ -0,0 +1,148 @@
+package rerank
+
+import (
+	"bytes"
+	"compliance-form-filler/pkg/llm"
+	"compliance-form-filler/pkg/retry"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Reranker rescores documents according to their relevance to the query, scores being between 0 and 1
+type Reranker interface {
+	Rerank(ctx context.Context, query string, documents []string) ([]float64, error)
+}
+
+// CrossEncoderRequest is the body expected by the rerank endpoint, following the text-embeddings-inference API.
+// RawScores asks for the logits of the model, which Rerank maps to [0, 1] itself.
+type CrossEncoderRequest struct {
+	Query     string   `json:"query"`
+	Texts     []string `json:"texts"`
+	RawScores bool     `json:"raw_scores"`
+}
+
+// CrossEncoderScore is the score of one of the texts of the request
+type CrossEncoderScore struct {
+	Index int     `json:"index"`
+	Score float64 `json:"score"`
+}
+
+// CrossEncoder calls a cross-encoder served from an HTTP endpoint
+type CrossEncoder struct {
+	URL     string
+	Breaker *retry.Breaker
+}
+
+// NewCrossEncoder creates a reranker calling the cross-encoder served at the given URL
+func NewCrossEncoder(url string, breaker *retry.Breaker) *CrossEncoder {
+	return &CrossEncoder{URL: url, Breaker: breaker}
+}
+
+// Rerank returns the score of each document, between 0 and 1, in the order of the documents
+func (c *CrossEncoder) Rerank(ctx context.Context, query string, documents []string) ([]float64, error) {
+	var scores []float64
+	err := c.Breaker.Do(ctx, func(ctx context.Context) error {
+		var err error
+		scores, err = c.rerankOnce(ctx, query, documents)
+		return err
+	})
+	return scores, err
+}
+
+func (c *CrossEncoder) rerankOnce(ctx context.Context, query string, documents []string) ([]float64, error) {
+	payload, err := json.Marshal(CrossEncoderRequest{Query: query, Texts: documents, RawScores: true})
+	if err != nil {
+		return nil, retry.Permanent(fmt.Errorf("failed to marshal rerank request: %w", err))
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.URL, bytes.NewBuffer(payload))
+	if err != nil {
+		return nil, retry.Permanent(fmt.Errorf("failed to create rerank request: %w", err))
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to reach reranker: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return nil, fmt.Errorf("reranker responded with: %w", &retry.StatusError{StatusCode: resp.StatusCode, Body: string(body)})
+	}
+
+	var res []CrossEncoderScore
+	if err := json.NewDecoder(resp.Body).Decode(&res); err != nil {
+		return nil, fmt.Errorf("invalid rerank response: %w", err)
+	}
+
+	scores := make([]float64, len(documents))
+	for _, score := range res {
+		if score.Index < 0 || score.Index >= len(documents) {
+			return nil, retry.Permanent(fmt.Errorf("rerank score index %d out of range", score.Index))
+		}
+		scores[score.Index] = sigmoid(score.Score)
+	}
+	return scores, nil
+}
+
+// sigmoid maps the logit of a cross-encoder to a relevance between 0 and 1
+func sigmoid(logit float64) float64 {
+	return 1 / (1 + math.Exp(-logit))
+}
+
+// relevanceLineRegexp matches the lines "<number>: <score>" of the LLM judge
+var relevanceLineRegexp = regexp.MustCompile(`^\s*(\d+)\s*[:.)-]\s*(\d+(?:\.\d+)?)`)
+
+// LLMJudge asks the LLM to rate the relevance of each document
+type LLMJudge struct {
+	Client *llm.Client
+}
+
+// NewLLMJudge creates a reranker asking the LLM to judge the relevance of the documents
+func NewLLMJudge(client *llm.Client) *LLMJudge {
+	return &LLMJudge{Client: client}
+}
+
+// Rerank returns the score of each document, in the order of the documents.
+// Documents the LLM did not rate get a score of 0.
+func (j *LLMJudge) Rerank(ctx context.Context, query string, documents []string) ([]float64, error) {
+	var promptBuilder strings.Builder
+	promptBuilder.WriteString("Rate how relevant each numbered document is to answer the question, from 0 (irrelevant) to 10 (answers it directly).\n")
+	promptBuilder.WriteString("Reply with one line per document, formatted exactly as \"<number>: <rating>\", and nothing else.\n\n")
+	promptBuilder.WriteString(fmt.Sprintf("Question: %s\n\nDocuments:\n", query))
+	for index, document := range documents {
+		promptBuilder.WriteString(fmt.Sprintf("%d: %s\n", index+1, document))
+	}
+
+	response, err := j.Client.SendMessagesToLLM(ctx, []llm.Message{{Role: llm.RoleUser, Content: promptBuilder.String()}})
+	if err != nil {
+		return nil, fmt.Errorf("failed to send relevance prompt to LLM: %w", err)
+	}
+
+	scores := make([]float64, len(documents))
+	for _, line := range strings.Split(response, "\n") {
+		match := relevanceLineRegexp.FindStringSubmatch(line)
+		if match == nil {
+			continue
+		}
+		index, err := strconv.Atoi(match[1])
+		if err != nil || index < 1 || index > len(documents) {
+			continue
+		}
+		rating, err := strconv.ParseFloat(match[2], 64)
+		if err != nil {
+			continue
+		}
+		scores[index-1] = min(max(rating/10, 0), 1)
+	}
+	return scores, nil
+}
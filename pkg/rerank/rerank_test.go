@@ -0,0 +1,51 @@
+package rerank
+
+import (
+	"compliance-form-filler/pkg/retry"
+	"context"
+	"encoding/json"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestCrossEncoderRerank(t *testing.T) {
+	tests := []struct {
+		name    string
+		logits  []CrossEncoderScore
+		want    []float64
+		wantErr bool
+	}{
+		{
+			name:   "logits mapped to [0, 1]",
+			logits: []CrossEncoderScore{{Index: 1, Score: 3.2}, {Index: 0, Score: -4.5}, {Index: 2, Score: 0}},
+			want:   []float64{0.0110, 0.9608, 0.5},
+		},
+		{name: "missing document scored low", logits: []CrossEncoderScore{{Index: 0, Score: 8}}, want: []float64{0.9997, 0, 0}},
+		{name: "index out of range", logits: []CrossEncoderScore{{Index: 3, Score: 1}}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				var request CrossEncoderRequest
+				if err := json.NewDecoder(r.Body).Decode(&request); err != nil || !request.RawScores || len(request.Texts) != 3 {
+					t.Errorf("unexpected request %+v: %v", request, err)
+				}
+				_ = json.NewEncoder(w).Encode(tt.logits)
+			}))
+			defer server.Close()
+
+			reranker := NewCrossEncoder(server.URL, retry.NewBreaker("reranker", 0, retry.Policy{MaxAttempts: 1}))
+			scores, err := reranker.Rerank(context.Background(), "Is data encrypted?", []string{"a", "b", "c"})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Rerank() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			for index, score := range scores {
+				if math.Abs(score-tt.want[index]) > 1e-4 {
+					t.Errorf("score of document %d = %f, want %f", index, score, tt.want[index])
+				}
+			}
+		})
+	}
+}
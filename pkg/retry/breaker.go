@@ -0,0 +1,53 @@
+package retry
+
+import (
+	"context"
+	"fmt"
+	"sync"
+)
+
+// Breaker fails fast once a dependency returned too many consecutive errors, instead of calling it again.
+// There is no half-open state: a run is short-lived, so a dependency clearly down aborts it.
+type Breaker struct {
+	// Name of the protected dependency, used in errors
+	Name string
+	// Threshold is the number of consecutive failed calls opening the circuit, 0 to disable
+	Threshold int
+	// Policy retries each call before it is counted as failed
+	Policy Policy
+
+	mutex    sync.Mutex
+	failures int
+}
+
+// NewBreaker creates a circuit breaker for the named dependency
+func NewBreaker(name string, threshold int, policy Policy) *Breaker {
+	return &Breaker{Name: name, Threshold: threshold, Policy: policy}
+}
+
+// Do calls fn through the retry policy, unless the circuit is open.
+// Only retryable errors, i.e. the dependency being unhealthy, count towards opening the circuit.
+func (b *Breaker) Do(ctx context.Context, fn func(ctx context.Context) error) error {
+	if b.Open() {
+		return fmt.Errorf("%s: %w after %d consecutive failures", b.Name, ErrCircuitOpen, b.Threshold)
+	}
+
+	err := b.Policy.Do(ctx, fn)
+
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	switch {
+	case err == nil:
+		b.failures = 0
+	case IsRetryable(err):
+		b.failures++
+	}
+	return err
+}
+
+// Open tells whether the circuit is open
+func (b *Breaker) Open() bool {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	return b.Threshold > 0 && b.failures >= b.Threshold
+}
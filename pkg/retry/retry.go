@@ -0,0 +1,117 @@
+package retry
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"net/http"
+	"time"
+)
+
+// ErrCircuitOpen is returned when a dependency failed too many times in a row to be called again
+var ErrCircuitOpen = errors.New("circuit breaker open")
+
+// StatusError is an error carrying the HTTP status code returned by a dependency
+type StatusError struct {
+	StatusCode int
+	Body       string
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("status %d: %s", e.StatusCode, e.Body)
+}
+
+// permanentError wraps an error that must not be retried
+type permanentError struct {
+	err error
+}
+
+func (e *permanentError) Error() string {
+	return e.err.Error()
+}
+
+func (e *permanentError) Unwrap() error {
+	return e.err
+}
+
+// Permanent marks an error as not retryable
+func Permanent(err error) error {
+	if err == nil {
+		return nil
+	}
+	return &permanentError{err: err}
+}
+
+// Policy describes how failed calls are retried
+type Policy struct {
+	// MaxAttempts is the maximum number of calls, including the first one
+	MaxAttempts int
+	// InitialBackoff is the wait before the first retry, doubled after each retry up to MaxBackoff
+	InitialBackoff time.Duration
+	MaxBackoff     time.Duration
+}
+
+// DefaultPolicy is the policy used when none is configured
+var DefaultPolicy = Policy{
+	MaxAttempts:    3,
+	InitialBackoff: 500 * time.Millisecond,
+	MaxBackoff:     10 * time.Second,
+}
+
+// IsRetryable tells whether the error is worth retrying: network errors and timeouts, 408, 429 and 5xx statuses.
+// Cancellations and errors marked as permanent are never retried.
+func IsRetryable(err error) bool {
+	if err == nil || errors.Is(err, context.Canceled) || errors.Is(err, ErrCircuitOpen) {
+		return false
+	}
+	var permanent *permanentError
+	if errors.As(err, &permanent) {
+		return false
+	}
+	var statusErr *StatusError
+	if errors.As(err, &statusErr) {
+		return IsRetryableStatus(statusErr.StatusCode)
+	}
+	return true
+}
+
+// IsRetryableStatus tells whether an HTTP status code denotes a transient failure
+func IsRetryableStatus(statusCode int) bool {
+	return statusCode == http.StatusRequestTimeout ||
+		statusCode == http.StatusTooManyRequests ||
+		statusCode >= http.StatusInternalServerError
+}
+
+// Do calls fn until it succeeds, returns a non retryable error, the attempts are exhausted or the context is done.
+// The waits between attempts grow exponentially, with a full jitter.
+func (p Policy) Do(ctx context.Context, fn func(ctx context.Context) error) error {
+	maxAttempts := max(p.MaxAttempts, 1)
+	var err error
+	for attempt := 1; ; attempt++ {
+		err = fn(ctx)
+		if err == nil || !IsRetryable(err) || attempt >= maxAttempts {
+			return err
+		}
+
+		wait := time.Duration(0)
+		if backoff := p.backoff(attempt); backoff > 0 {
+			wait = rand.N(backoff) + 1
+		}
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(wait):
+		}
+	}
+}
+
+// backoff returns the longest wait after the given failed attempt: InitialBackoff after the first one,
+// doubled after each of the next ones up to MaxBackoff
+func (p Policy) backoff(attempt int) time.Duration {
+	backoff := p.InitialBackoff
+	for ; attempt > 1; attempt-- {
+		backoff = min(backoff*2, p.MaxBackoff)
+	}
+	return backoff
+}
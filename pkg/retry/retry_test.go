@@ -0,0 +1,156 @@
+package retry
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestIsRetryable(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{name: "nil", err: nil, want: false},
+		{name: "network error", err: errors.New("connection refused"), want: true},
+		{name: "deadline exceeded", err: context.DeadlineExceeded, want: true},
+		{name: "canceled", err: fmt.Errorf("request failed: %w", context.Canceled), want: false},
+		{name: "circuit open", err: fmt.Errorf("LLM: %w", ErrCircuitOpen), want: false},
+		{name: "permanent", err: Permanent(errors.New("invalid request")), want: false},
+		{name: "wrapped permanent", err: fmt.Errorf("rerank: %w", Permanent(&StatusError{StatusCode: http.StatusServiceUnavailable})), want: false},
+		{name: "request timeout", err: &StatusError{StatusCode: http.StatusRequestTimeout}, want: true},
+		{name: "too many requests", err: fmt.Errorf("LLM responded with: %w", &StatusError{StatusCode: http.StatusTooManyRequests}), want: true},
+		{name: "internal server error", err: &StatusError{StatusCode: http.StatusInternalServerError}, want: true},
+		{name: "service unavailable", err: &StatusError{StatusCode: http.StatusServiceUnavailable}, want: true},
+		{name: "bad request", err: &StatusError{StatusCode: http.StatusBadRequest}, want: false},
+		{name: "not found", err: &StatusError{StatusCode: http.StatusNotFound}, want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := IsRetryable(tt.err); got != tt.want {
+				t.Errorf("IsRetryable(%v) = %t, want %t", tt.err, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPermanentNil(t *testing.T) {
+	if err := Permanent(nil); err != nil {
+		t.Errorf("Permanent(nil) = %v, want nil", err)
+	}
+}
+
+func TestPolicyDo(t *testing.T) {
+	transient := &StatusError{StatusCode: http.StatusServiceUnavailable}
+	badRequest := &StatusError{StatusCode: http.StatusBadRequest}
+	tests := []struct {
+		name      string
+		policy    Policy
+		errors    []error
+		wantCalls int
+		wantErr   error
+	}{
+		{name: "success", policy: Policy{MaxAttempts: 3}, errors: []error{nil}, wantCalls: 1},
+		{name: "success after retries", policy: Policy{MaxAttempts: 3}, errors: []error{transient, transient, nil}, wantCalls: 3},
+		{name: "attempts exhausted", policy: Policy{MaxAttempts: 3}, errors: []error{transient, transient, transient, nil}, wantCalls: 3, wantErr: transient},
+		{name: "permanent error not retried", policy: Policy{MaxAttempts: 3}, errors: []error{Permanent(transient), nil}, wantCalls: 1, wantErr: transient},
+		{name: "client error not retried", policy: Policy{MaxAttempts: 3}, errors: []error{badRequest, nil}, wantCalls: 1, wantErr: badRequest},
+		{name: "at least one attempt", policy: Policy{}, errors: []error{transient, nil}, wantCalls: 1, wantErr: transient},
+		{name: "backoff waited", policy: Policy{MaxAttempts: 2, InitialBackoff: time.Millisecond, MaxBackoff: time.Millisecond}, errors: []error{transient, nil}, wantCalls: 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			calls := 0
+			err := tt.policy.Do(context.Background(), func(ctx context.Context) error {
+				calls++
+				return tt.errors[calls-1]
+			})
+			if calls != tt.wantCalls {
+				t.Errorf("Do() called fn %d times, want %d", calls, tt.wantCalls)
+			}
+			if tt.wantErr == nil && err != nil {
+				t.Errorf("Do() error = %v, want nil", err)
+			}
+			if tt.wantErr != nil && !errors.Is(err, tt.wantErr) {
+				t.Errorf("Do() error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestPolicyDoStopsOnCancel(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	policy := Policy{MaxAttempts: 5, InitialBackoff: time.Hour, MaxBackoff: time.Hour}
+	calls := 0
+	done := make(chan error, 1)
+	go func() {
+		done <- policy.Do(ctx, func(ctx context.Context) error {
+			calls++
+			cancel()
+			return errors.New("connection reset")
+		})
+	}()
+	select {
+	case err := <-done:
+		if err == nil || calls != 1 {
+			t.Errorf("Do() = %v after %d calls, want the error of the only call", err, calls)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Do() kept waiting after the context was canceled")
+	}
+}
+
+func TestPolicyBackoff(t *testing.T) {
+	policy := Policy{InitialBackoff: 500 * time.Millisecond, MaxBackoff: 3 * time.Second}
+	want := []time.Duration{500 * time.Millisecond, time.Second, 2 * time.Second, 3 * time.Second, 3 * time.Second}
+	for index, backoff := range want {
+		if got := policy.backoff(index + 1); got != backoff {
+			t.Errorf("backoff(%d) = %s, want %s", index+1, got, backoff)
+		}
+	}
+	if got := (Policy{}).backoff(3); got != 0 {
+		t.Errorf("backoff without initial backoff = %s, want 0", got)
+	}
+}
+
+func TestBreaker(t *testing.T) {
+	transient := &StatusError{StatusCode: http.StatusBadGateway}
+	tests := []struct {
+		name      string
+		threshold int
+		results   []error
+		wantOpen  bool
+	}{
+		{name: "opens after threshold failures", threshold: 2, results: []error{transient, transient}, wantOpen: true},
+		{name: "below threshold", threshold: 3, results: []error{transient, transient}, wantOpen: false},
+		{name: "reset after a success", threshold: 2, results: []error{transient, nil, transient}, wantOpen: false},
+		{name: "permanent errors not counted", threshold: 2, results: []error{Permanent(transient), Permanent(transient)}, wantOpen: false},
+		{name: "disabled", threshold: 0, results: []error{transient, transient, transient}, wantOpen: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			breaker := NewBreaker("LLM", tt.threshold, Policy{MaxAttempts: 1})
+			for _, result := range tt.results {
+				_ = breaker.Do(context.Background(), func(ctx context.Context) error { return result })
+			}
+			if got := breaker.Open(); got != tt.wantOpen {
+				t.Fatalf("Open() = %t, want %t", got, tt.wantOpen)
+			}
+			if !tt.wantOpen {
+				return
+			}
+			called := false
+			err := breaker.Do(context.Background(), func(ctx context.Context) error {
+				called = true
+				return nil
+			})
+			if called || !errors.Is(err, ErrCircuitOpen) {
+				t.Errorf("Do() on an open circuit = %v, called %t, want ErrCircuitOpen without call", err, called)
+			}
+		})
+	}
+}
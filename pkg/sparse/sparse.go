@@ -0,0 +1,92 @@
+package sparse
+
+import (
+	"hash/fnv"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// k1 controls the saturation of the term frequency, as in BM25.
+// The inverse document frequency is applied by Qdrant, using the IDF modifier of the sparse vector.
+const k1 = 1.2
+
+// Tokenize splits the text into lowercase terms: words, numbers, and bigrams of adjacent words
+// so that multi-word terms like "SOC 2" or "Type II" are matched as a whole.
+func Tokenize(text string) []string {
+	words := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	terms := make([]string, 0, 2*len(words))
+	terms = append(terms, words...)
+	for i := 1; i < len(words); i++ {
+		terms = append(terms, words[i-1]+" "+words[i])
+	}
+	return terms
+}
+
+// EncodeDocument returns the sparse vector of a chunk, weighting each term by its saturated frequency
+func EncodeDocument(text string) ([]uint32, []float32) {
+	frequencies := termFrequencies(Tokenize(text))
+	return toVector(frequencies, func(tf float32) float32 {
+		return tf * (k1 + 1) / (tf + k1)
+	})
+}
+
+// stopWords are left out of the queries, since questions are full of them and a chunk matching only them is not relevant.
+// Chunks keep them, so that the bigrams of a query made of a stop word and another word are still matched.
+var stopWords = map[string]bool{
+	"a": true, "an": true, "the": true, "and": true, "or": true, "of": true, "to": true, "in": true, "on": true, "at": true,
+	"by": true, "for": true, "with": true, "from": true, "as": true, "is": true, "are": true, "be": true, "been": true,
+	"was": true, "were": true, "do": true, "does": true, "did": true, "have": true, "has": true, "had": true, "you": true,
+	"your": true, "we": true, "our": true, "it": true, "its": true, "this": true, "that": true, "these": true, "those": true,
+	"there": true, "any": true, "all": true, "what": true, "which": true, "who": true, "how": true, "when": true,
+	"where": true, "why": true, "can": true, "if": true, "please": true, "describe": true, "provide": true,
+}
+
+// EncodeQuery returns the sparse vector of a query, each distinct term weighting 1.
+// Stop words, and bigrams made only of them, are left out.
+func EncodeQuery(text string) ([]uint32, []float32) {
+	frequencies := termFrequencies(queryTerms(text))
+	return toVector(frequencies, func(float32) float32 {
+		return 1
+	})
+}
+
+// queryTerms returns the terms of Tokenize, without the stop words and the bigrams made only of stop words
+func queryTerms(text string) []string {
+	var terms []string
+	for _, term := range Tokenize(text) {
+		first, second, bigram := strings.Cut(term, " ")
+		if stopWords[first] && (!bigram || stopWords[second]) {
+			continue
+		}
+		terms = append(terms, term)
+	}
+	return terms
+}
+
+// termFrequencies counts the terms by index, the index of a term being its FNV-1a hash
+func termFrequencies(terms []string) map[uint32]float32 {
+	frequencies := make(map[uint32]float32, len(terms))
+	for _, term := range terms {
+		hash := fnv.New32a()
+		hash.Write([]byte(term))
+		frequencies[hash.Sum32()]++
+	}
+	return frequencies
+}
+
+func toVector(frequencies map[uint32]float32, weight func(tf float32) float32) ([]uint32, []float32) {
+	indices := make([]uint32, 0, len(frequencies))
+	for index := range frequencies {
+		indices = append(indices, index)
+	}
+	// Sort the indices to get a deterministic vector
+	sort.Slice(indices, func(i, j int) bool { return indices[i] < indices[j] })
+	values := make([]float32, len(indices))
+	for i, index := range indices {
+		values[i] = weight(frequencies[index])
+	}
+	return indices, values
+}
@@ -0,0 +1,43 @@
+package sparse
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestQueryTerms(t *testing.T) {
+	tests := []struct {
+		text string
+		want []string
+	}{
+		{text: "Do you have a SOC 2 report?", want: []string{"soc", "2", "report", "a soc", "soc 2", "2 report"}},
+		{text: "Is data encrypted at rest?", want: []string{"data", "encrypted", "rest", "is data", "data encrypted", "encrypted at", "at rest"}},
+		{text: "Do you have any?", want: nil},
+		{text: "", want: nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.text, func(t *testing.T) {
+			if got := queryTerms(tt.text); !slices.Equal(got, tt.want) {
+				t.Errorf("queryTerms(%q) = %q, want %q", tt.text, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestEncodeQuery(t *testing.T) {
+	indices, values := EncodeQuery("Do you have a SOC 2 report? SOC 2!")
+	if len(indices) != 7 || len(values) != 7 {
+		t.Fatalf("EncodeQuery() has %d indices and %d values, want 7", len(indices), len(values))
+	}
+	if !slices.IsSorted(indices) {
+		t.Errorf("EncodeQuery() indices not sorted: %v", indices)
+	}
+	for _, value := range values {
+		if value != 1 {
+			t.Errorf("EncodeQuery() value = %f, want 1", value)
+		}
+	}
+	if indices, _ := EncodeQuery("Do you have any?"); len(indices) != 0 {
+		t.Errorf("EncodeQuery() of stop words only = %v, want no index", indices)
+	}
+}
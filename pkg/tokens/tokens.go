@@ -0,0 +1,52 @@
+package tokens
+
+import (
+	"math"
+	"strings"
+	"unicode/utf8"
+)
+
+// messageOverhead is the number of tokens added by the chat template around each message
+const messageOverhead = 4
+
+// defaultCharactersPerToken is used for unknown model families, on the low side so the estimate errs on the safe side
+const defaultCharactersPerToken = 3.2
+
+// charactersPerToken is the average number of characters per token of the tokenizer of each model family,
+// measured on English compliance documents
+var charactersPerToken = map[string]float64{
+	"llama":    4.0,
+	"deepseek": 3.8,
+	"qwen":     3.8,
+	"gemma":    4.0,
+	"mistral":  3.4,
+	"mixtral":  3.4,
+	"phi":      3.4,
+}
+
+// Estimate returns the approximate number of tokens of the text for the model, e.g. "deepseek-r1:8b".
+// Tokenizers are not available in Go, so the count derives from the average token length of the model family.
+func Estimate(model, text string) int {
+	if text == "" {
+		return 0
+	}
+	return int(math.Ceil(float64(utf8.RuneCountInString(text)) / ratio(model)))
+}
+
+// EstimateMessage returns the approximate number of tokens of a chat message, including the chat template
+func EstimateMessage(model, content string) int {
+	return Estimate(model, content) + messageOverhead
+}
+
+func ratio(model string) float64 {
+	model = strings.ToLower(model)
+	if index := strings.LastIndex(model, "/"); index >= 0 {
+		model = model[index+1:]
+	}
+	for family, charactersPerToken := range charactersPerToken {
+		if strings.HasPrefix(model, family) {
+			return charactersPerToken
+		}
+	}
+	return defaultCharactersPerToken
+}
@@ -0,0 +1,36 @@
+package tokens
+
+import "testing"
+
+func TestEstimate(t *testing.T) {
+	tests := []struct {
+		name  string
+		model string
+		text  string
+		want  int
+	}{
+		{name: "empty text", model: "llama3.1:8b", text: "", want: 0},
+		{name: "known family", model: "llama3.1:8b", text: "12345678", want: 2},
+		{name: "rounded up", model: "llama3.1:8b", text: "123456789", want: 3},
+		{name: "case insensitive", model: "Qwen2.5:14b", text: "1234567890123456789", want: 5},
+		{name: "namespaced model", model: "library/mistral:7b", text: "1234567", want: 3},
+		{name: "unknown family", model: "custom-model", text: "1234567890123456", want: 5},
+		{name: "counted in runes", model: "llama3", text: "sécurité", want: 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Estimate(tt.model, tt.text); got != tt.want {
+				t.Errorf("Estimate(%q, %q) = %d, want %d", tt.model, tt.text, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestEstimateMessage(t *testing.T) {
+	if got, want := EstimateMessage("llama3", "12345678"), 2+messageOverhead; got != want {
+		t.Errorf("EstimateMessage() = %d, want %d", got, want)
+	}
+	if got := EstimateMessage("llama3", ""); got != messageOverhead {
+		t.Errorf("EstimateMessage() of an empty message = %d, want %d", got, messageOverhead)
+	}
+}